@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//get blob category by category name
+func blobCategory(name string) (comm.BlobCategory, bool) {
+	for _, cat := range comm.BlobCategories {
+		if cat.Name == name {
+			return cat, true
+		}
+	}
+	return comm.BlobCategory{}, false
+}
+
+//get blob category of message name by prefix, the longest prefix matches if prefixes overlap
+func blobCategoryOfName(name string) (comm.BlobCategory, bool) {
+	found := false
+	var ret comm.BlobCategory
+	for _, cat := range comm.BlobCategories {
+		if cat.Prefix == "" || !strings.HasPrefix(name, cat.Prefix) {
+			continue
+		}
+		if !found || len(cat.Prefix) > len(ret.Prefix) {
+			ret = cat
+			found = true
+		}
+	}
+	return ret, found
+}
+
+//get injected columns of blob table, the primary keys of blob category replace the key columns
+//key column not in injected columns is added as uint64 head column
+func blobColumns(cat comm.BlobCategory) []comm.Column {
+	columns := injectedColumns(cat.Table, "BLOB")
+	if len(cat.Keys) == 0 {
+		return columns
+	}
+	var ret []comm.Column
+	for _, key := range cat.Keys {
+		col := comm.Column{Name: key, Type: "uint64", Position: "head", IsKey: true}
+		for _, c := range columns {
+			if c.Name == key {
+				col = c
+				col.IsKey = true
+			}
+		}
+		ret = append(ret, col)
+	}
+	for _, c := range columns {
+		if !c.IsKey && !containsString(cat.Keys, c.Name) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+//rough estimate of encoded size in bytes of field types, used for splitting blob tables
+//other types (messages) are estimated by their fields
+var typeSizes = map[string]int{
+	"bool": 2, "int32": 6, "uint32": 6, "sint32": 6, "int64": 11, "uint64": 11, "sint64": 11,
+	"fixed32": 5, "sfixed32": 5, "float": 5, "fixed64": 9, "sfixed64": 9, "double": 9,
+	"string": 34, "bytes": 66,
+}
+
+//estimated element num of repeated and map fields
+const repeatedSize int = 8
+
+//check whether blob category is split into several blob tables
+func isSplitBlobCategory(cat comm.BlobCategory) bool {
+	return cat.MaxColumns > 0 || cat.MaxSize > 0
+}
+
+//get name of split blob table before naming policy applied, such as BlobUserDataOut_1
+func splitBlobTableName(cat comm.BlobCategory, index int) string {
+	return fmt.Sprintf("%s_%d", cat.Table, index+1)
+}
+
+//assign blob messages to split blob tables
+//messages assigned in lock file stay in their tables, new messages are added to the first table with enough room
+func assignBlobTables(cat comm.BlobCategory, msgs []string) [][]string {
+	exist := map[string]bool{}
+	for _, name := range msgs {
+		exist[name] = true
+	}
+	assigned := map[string]bool{}
+	var groups [][]string
+	for _, group := range lock.BlobTables[cat.Name] {
+		//removed messages are dropped, the empty table is kept for stable table names
+		kept := []string{}
+		for _, name := range group {
+			if exist[name] && !assigned[name] {
+				kept = append(kept, name)
+				assigned[name] = true
+			}
+		}
+		if len(kept) > 1 && !blobTableFits(cat, kept[:len(kept)-1], kept[len(kept)-1]) {
+			addWarning(fmt.Sprintf("%s exceeds limits of blob category %s, remove it from %s to reassign messages",
+				tableName(splitBlobTableName(cat, len(groups))), cat.Name, comm.LockFile))
+		}
+		groups = append(groups, kept)
+	}
+	for _, name := range msgs {
+		if assigned[name] {
+			continue
+		}
+		placed := false
+		for i := range groups {
+			if blobTableFits(cat, groups[i], name) {
+				groups[i] = append(groups[i], name)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			if !blobTableFits(cat, []string{}, name) {
+				addWarning(fmt.Sprintf("%s exceeds limits of blob category %s, put into a table alone", name, cat.Name))
+			}
+			groups = append(groups, []string{name})
+		}
+		assigned[name] = true
+	}
+	lock.BlobTables[cat.Name] = groups
+	return groups
+}
+
+//check whether message can be added to blob table with the messages, both column num and estimated size are checked
+func blobTableFits(cat comm.BlobCategory, group []string, name string) bool {
+	if cat.MaxColumns > 0 && len(blobColumns(cat))+len(group)+1 > cat.MaxColumns {
+		return false
+	}
+	if cat.MaxSize > 0 {
+		size := estimateMessageSize(name, map[string]bool{})
+		for _, n := range group {
+			size = size + estimateMessageSize(n, map[string]bool{})
+		}
+		if size > cat.MaxSize {
+			return false
+		}
+	}
+	return true
+}
+
+//estimate encoded size of message by its fields, visited avoids endless recursion of nested messages
+func estimateMessageSize(name string, visited map[string]bool) int {
+	msg, ok := findMessage(name)
+	if !ok || visited[name] {
+		return typeSizes["bytes"]
+	}
+	visited[name] = true
+	defer delete(visited, name)
+	size := 0
+	for _, field := range msg.Fields {
+		fsize := estimateTypeSize(field.Type, visited)
+		if field.IsRepeated {
+			fsize = fsize * repeatedSize
+		}
+		size = size + fsize
+	}
+	for _, mapf := range msg.Maps {
+		size = size + (estimateTypeSize(mapf.KeyType, visited)+estimateTypeSize(mapf.Field.Type, visited))*repeatedSize
+	}
+	return size
+}
+
+func estimateTypeSize(ftype string, visited map[string]bool) int {
+	if size, ok := typeSizes[ftype]; ok {
+		return size
+	}
+	if _, ok := findMessage(ftype); ok {
+		return estimateMessageSize(ftype, visited)
+	}
+	//enum type
+	return typeSizes["int32"]
+}
+
+//find parsed source message by name, nested messages are not searched
+func findMessage(name string) (comm.Message, bool) {
+	name = name[strings.LastIndex(name, ".")+1:]
+	for _, info := range protoInfos {
+		for _, msg := range info.msgs {
+			if msg.Name == name {
+				return msg, true
+			}
+		}
+	}
+	return comm.Message{}, false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestAssignBlobTables(t *testing.T) {
+	resetParseState()
+	cfgFile = "config/proto_parse.cfg"
+	assert.NoError(t, loadConfig())
+	//UID and UpdateTime are injected, so each blob table holds two messages
+	cat := comm.BlobCategory{Name: "OUT", Table: "BlobUserDataOut", MaxColumns: 4}
+	cases := []struct {
+		name   string
+		lock   [][]string
+		msgs   []string
+		groups [][]string
+	}{
+		{"no lock", nil, []string{"A", "B", "C", "D", "E"}, [][]string{{"A", "B"}, {"C", "D"}, {"E"}}},
+		{"same messages", [][]string{{"C", "A"}, {"B"}}, []string{"A", "B", "C"}, [][]string{{"C", "A"}, {"B"}}},
+		{"new message", [][]string{{"C", "A"}, {"B"}}, []string{"A", "B", "C", "D"}, [][]string{{"C", "A"}, {"B", "D"}}},
+		{"new message fills removed one", [][]string{{"C", "A"}, {"B"}}, []string{"B", "C", "D"}, [][]string{{"C", "D"}, {"B"}}},
+		{"table emptied", [][]string{{"A"}, {"B"}}, []string{"B"}, [][]string{{}, {"B"}}},
+	}
+	for _, c := range cases {
+		lock = lockInfo{BlobTables: map[string][][]string{}, Tables: map[string]lockTable{}}
+		if c.lock != nil {
+			lock.BlobTables[cat.Name] = c.lock
+		}
+		assert.Equal(t, c.groups, assignBlobTables(cat, c.msgs), c.name)
+		assert.Equal(t, c.groups, lock.BlobTables[cat.Name], c.name)
+		//assigned again with the lock saved by previous run
+		assert.Equal(t, c.groups, assignBlobTables(cat, c.msgs), c.name)
+	}
+}
+
+func TestSplitBlobTablesStable(t *testing.T) {
+	configSets = []string{"blob_max_columns=OUT:3"}
+	defer func() { configSets = nil }()
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, [][]string{{"OUT_ChaosBattle"}}, lock.BlobTables["OUT"])
+
+	//message added before existing one is put into a new table, existing message stays in its table
+	editFile(t, filepath.Join(src, "chaos_battle.proto"), func(s string) string {
+		return strings.Replace(s, "message OUT_ChaosBattle {", "message OUT_Arena {\n    EntityType dType = 1;\n    uint32 score = 2;\n}\nmessage OUT_ChaosBattle {", 1)
+	})
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, convertForTest(t, src, dst))
+		assert.Equal(t, [][]string{{"OUT_ChaosBattle"}, {"OUT_Arena"}}, lock.BlobTables["OUT"])
+	}
+}
+
+func TestBlobCategoryOfName(t *testing.T) {
+	comm.ResetConfig()
+	defer comm.ResetConfig()
+	comm.BlobCategories = []comm.BlobCategory{{Name: "OUT", Prefix: "OUT_"}, {Name: "GUILD", Prefix: "OUT_Guild_"}, {Name: "NOPREFIX"}}
+	for name, want := range map[string]string{"OUT_Bag": "OUT", "OUT_Guild_Bank": "GUILD", "OUT_Guild": "OUT", "IN_Bag": "", "Bag": ""} {
+		cat, ok := blobCategoryOfName(name)
+		assert.Equal(t, want != "", ok, name)
+		assert.Equal(t, want, cat.Name, name)
+	}
+}
+
+func TestBlobColumns(t *testing.T) {
+	comm.ResetConfig()
+	defer comm.ResetConfig()
+	comm.InjectedColumns = map[string][]comm.Column{"BLOB": {
+		{Name: "UID", Type: "uint64", Position: "head", IsKey: true},
+		{Name: "Zone", Type: "uint32", Position: "head"},
+		{Name: "UpdateTime", Type: "uint64", Position: "tail"},
+	}}
+	//injected columns are used without keys of category
+	assert.Equal(t, comm.InjectedColumns["BLOB"], blobColumns(comm.BlobCategory{Name: "OUT", Table: "BlobUserDataOut"}))
+	//keys of category replace the key columns, key in injected columns keeps its type and position, other keys are uint64 head columns
+	assert.Equal(t, []comm.Column{
+		{Name: "Zone", Type: "uint32", Position: "head", IsKey: true},
+		{Name: "GuildID", Type: "uint64", Position: "head", IsKey: true},
+		{Name: "UpdateTime", Type: "uint64", Position: "tail"},
+	}, blobColumns(comm.BlobCategory{Name: "GUILD", Table: "BlobGuild", Keys: []string{"Zone", "GuildID"}}))
+}
+
+func TestCustomBlobCategory(t *testing.T) {
+	//category with its own prefix, table and keys is generated into its own proto file
+	configSets = []string{"blob_proto_files=IN:blob_user_data_in.proto, OUT:blob_user_data_out.proto, SOCIAL:blob_user_data_social.proto, GUILD:blob_guild.proto:G_:BlobGuild:GuildID#Zone"}
+	defer func() { configSets = nil }()
+	src, dst := copyTestdata(t), t.TempDir()
+	editFile(t, filepath.Join(src, "guild.proto"), func(s string) string {
+		return s + "\nmessage G_Bank {\n\tEntityType dType = 1;\n\tuint64 gold = 2;\n}\n"
+	})
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, map[string]string{}, errorInfos)
+	out, err := ioutil.ReadFile(filepath.Join(dst, "blob_guild.proto"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "message BlobGuild { \n\toption(tcaplusservice.tcaplus_primary_key) = \"GuildID,Zone\";\n"+
+		"\tuint64 GuildID = 1;\n\tuint64 Zone = 2;\n\tuint64 UpdateTime = 3;\n\tbytes G_Bank = 4;\n}")
+	//SOCIAL category without its own table name and keys takes the default ones
+	cat, ok := blobCategory("SOCIAL")
+	assert.True(t, ok)
+	assert.Equal(t, comm.BlobCategory{Name: "SOCIAL", Prefix: "SOCIAL_", Table: "BlobUserDataSocial", File: "blob_user_data_social.proto"}, cat)
+	social, ok := findTable("SOCIAL_Friends")
+	assert.True(t, ok)
+	assert.Equal(t, "UID", social.option(primaryKeyOption))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//classification result of source message
+type msgClass struct {
+	//message kind: BASE, SPLIT, PUB, LIST, BLOB or COMM (not a table)
+	kind string
+	//blob type of BLOB message, such as IN, OUT
+	blobType string
+	//primary keys specified by table annotation, comma separates each key
+	keys string
+	//max element num of LIST table specified by table annotation
+	listNum string
+	//the rule which decides the kind
+	rule string
+}
+
+//kinds of table annotation
+var annotationKinds = []string{"BASE", "SPLIT", "PUB", "LIST", "BLOB", "COMM"}
+
+//classify message, table annotation takes precedence over naming rules
+//conflict between table annotation and naming rules is reported as warning
+func classifyMessage(msg comm.Message) msgClass {
+	class := classifyByNamingRules(msg)
+	opt, ok := tableAnnotation(msg)
+	if !ok {
+		if len(comm.EntityKeyTypes) > 0 {
+			if anyType := classifyByAnyKeyType(msg); anyType.kind != class.kind || anyType.blobType != class.blobType {
+				addWarning(fmt.Sprintf("%s classified as %s by %s instead of %s by %s, as entity key type is not one of entity_key_types",
+					msg.Name, kindString(class), class.rule, kindString(anyType), anyType.rule))
+			}
+		}
+		for _, match := range entityNearMatches(msg, class) {
+			addWarning(fmt.Sprintf("%s classified as %s by %s, %s", msg.Name, kindString(class), class.rule, match))
+		}
+		return class
+	}
+	annotated, err := classifyByAnnotation(msg, opt)
+	if err != nil {
+		addWarning(fmt.Sprintf("%s table annotation error: %v, classified by %s", msg.Name, err, class.rule))
+		return class
+	}
+	if class.kind != "COMM" && (class.kind != annotated.kind || class.blobType != annotated.blobType) {
+		addWarning(fmt.Sprintf("%s annotated as %s conflicts with %s (%s), annotation is used",
+			msg.Name, kindString(annotated), class.rule, kindString(class)))
+	}
+	return annotated
+}
+
+//classify message by name prefix, entity marker (EntityType) and entity key (UUID) fields, and base_tables config
+func classifyByNamingRules(msg comm.Message) msgClass {
+	if ok := isListMessageType(msg); ok {
+		return msgClass{kind: "LIST", rule: "list rule"}
+	} else if blobType, ok := isBlobMessageType(msg); ok {
+		return msgClass{kind: "BLOB", blobType: blobType, rule: "blob rule"}
+	} else if _, ok := isInOrOutMessageType(msg); ok {
+		return msgClass{kind: "SPLIT", rule: "split rule"}
+	} else if _, ok := isPubMessageType(msg); ok {
+		return msgClass{kind: "PUB", rule: "pub rule"}
+	} else if ok := isBaseMessageType(msg); ok {
+		return msgClass{kind: "BASE", rule: "base_tables config"}
+	}
+	return msgClass{kind: "COMM", rule: "default rule"}
+}
+
+//classify message by naming rules as if entity key of any type is allowed, the same as without entity_key_types
+func classifyByAnyKeyType(msg comm.Message) msgClass {
+	keyTypes := comm.EntityKeyTypes
+	comm.EntityKeyTypes = nil
+	defer func() { comm.EntityKeyTypes = keyTypes }()
+	return classifyByNamingRules(msg)
+}
+
+//get table annotation of message, such as `option (tcaplus.table) = {kind: SPLIT, keys: "UUID,UID"};`
+func tableAnnotation(msg comm.Message) (comm.Option, bool) {
+	for _, opt := range msg.Options {
+		if opt.Name == comm.TableAnnotation {
+			return opt, true
+		}
+	}
+	return comm.Option{}, false
+}
+
+//classify message by table annotation
+func classifyByAnnotation(msg comm.Message, opt comm.Option) (msgClass, error) {
+	class := msgClass{rule: fmt.Sprintf("%s annotation", comm.TableAnnotation)}
+	for _, item := range opt.Aggregated {
+		switch item.Name {
+		case "kind":
+			class.kind = strings.ToUpper(item.Value)
+		case "keys":
+			class.keys = strings.Join(splitKeys(item.Value), ",")
+		case "blob":
+			class.blobType = item.Value
+		case "list_num":
+			class.listNum = item.Value
+		default:
+			return class, fmt.Errorf("unknown item %s", item.Name)
+		}
+	}
+	if class.kind == "" {
+		return class, fmt.Errorf("kind not specified")
+	}
+	if !isAnnotationKind(class.kind) {
+		return class, fmt.Errorf("unknown kind %s", class.kind)
+	}
+	if class.kind == "BLOB" && class.blobType == "" {
+		//blob type not specified, use the blob type of name prefix
+		class.blobType = blobTypeOfName(msg.Name)
+	}
+	if class.kind == "BLOB" {
+		if _, ok := blobCategory(class.blobType); !ok {
+			return class, fmt.Errorf("unknown blob type %q", class.blobType)
+		}
+	} else if class.blobType != "" {
+		return class, fmt.Errorf("blob specified for %s kind", class.kind)
+	}
+	if class.kind == "BASE" && class.keys == "" {
+		if _, ok := comm.BaseTableMap[msg.Name]; !ok {
+			return class, fmt.Errorf("keys not specified for BASE kind")
+		}
+	}
+	if class.kind == "BLOB" && class.keys != "" {
+		return class, fmt.Errorf("keys specified for BLOB kind, specify keys of blob category in blob_proto_files")
+	}
+	return class, nil
+}
+
+func isAnnotationKind(kind string) bool {
+	for _, k := range annotationKinds {
+		if kind == k {
+			return true
+		}
+	}
+	return false
+}
+
+//get blob type from message name prefix, empty string returned if no blob prefix
+func blobTypeOfName(name string) string {
+	if cat, ok := blobCategoryOfName(name); ok {
+		return cat.Name
+	}
+	return ""
+}
+
+func kindString(class msgClass) string {
+	if class.kind == "BLOB" {
+		return fmt.Sprintf("%s(%s)", class.kind, class.blobType)
+	}
+	return class.kind
+}
+
+//split comma separated keys and trim spaces
+func splitKeys(keys string) []string {
+	var ret []string
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" {
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
+
+//get primary key of table, primary keys of table annotation take precedence over default primary keys
+//default primary keys are the keys of source message (base_table_primary_keys or entity key) followed by injected key columns
+func tablePrimaryKey(tableName string, msgType string) (string, bool) {
+	if class, ok := msgClasses[tableName]; ok && class.keys != "" {
+		return class.keys, true
+	}
+	var keys []string
+	switch msgType {
+	case "BASE":
+		pk, ok := comm.BaseTableMap[tableName]
+		if !ok {
+			return "", false
+		}
+		keys = append(keys, pk)
+	case "SPLIT", "PUB":
+		msg, ok := findMessage(tableName)
+		if !ok || entityKeyName(msg) == "" {
+			return "", false
+		}
+		keys = append(keys, entityKeyName(msg))
+	}
+	if colKeys := columnKeys(injectedColumns(tableName, msgType)); colKeys != "" {
+		keys = append(keys, colKeys)
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+	return strings.Join(keys, ","), true
+}
+
+//check whether key is part of primary key
+func isPrimaryKeyField(key string, primaryKey string) bool {
+	for _, pk := range splitKeys(primaryKey) {
+		if pk == key {
+			return true
+		}
+	}
+	return false
+}
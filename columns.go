@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//get injected columns of table, the columns of table override the columns of its category
+func injectedColumns(tableName string, category string) []comm.Column {
+	if columns, ok := comm.InjectedColumns[tableName]; ok {
+		return columns
+	}
+	return comm.InjectedColumns[category]
+}
+
+//get injected columns at specified position, head or tail
+func columnsAt(columns []comm.Column, position string) []comm.Column {
+	var ret []comm.Column
+	for _, col := range columns {
+		if col.Position == position {
+			ret = append(ret, col)
+		}
+	}
+	return ret
+}
+
+//get names of injected key columns, comma separates each name
+func columnKeys(columns []comm.Column) string {
+	var keys []string
+	for _, col := range columns {
+		if col.IsKey {
+			keys = append(keys, col.Name)
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+//check that injected columns do not conflict with message fields, names are compared after naming policy applied
+func checkInjectedColumns(msg comm.Message, columns []comm.Column) error {
+	for _, col := range columns {
+		for _, field := range msg.Fields {
+			if strings.EqualFold(policyName(col.Name), policyName(field.Name)) {
+				return fmt.Errorf("write %s message error, injected column %s conflicts with field %s", msg.Name, col.Name, field.Name)
+			}
+		}
+		for _, mapf := range msg.Maps {
+			if strings.EqualFold(policyName(col.Name), policyName(mapf.Field.Name)) {
+				return fmt.Errorf("write %s message error, injected column %s conflicts with field %s", msg.Name, col.Name, mapf.Field.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -1,5 +1,7 @@
 package comm
 
+import "regexp"
+
 var (
 	//default base tables
 	GlobalBaseTables = [...]string{"BaseVersion", "BaseGUID", "BaseSelfIncrementIDData", "BaseAccounts", "BaseRoles"}
@@ -17,18 +19,62 @@ var (
 		"PUB":  "table_pub_message.proto",
 		"OUT":  "table_split_message.proto",
 		"IN":   "table_split_message.proto",
+		"LIST": "table_list_message.proto",
+	}
+	//blob categories
+	GlobalBlobCategories = []BlobCategory{
+		{Name: "IN", Prefix: "IN_", File: "blob_user_data_in.proto"},
+		{Name: "OUT", Prefix: "OUT_", File: "blob_user_data_out.proto"},
+	}
+	//sharding keys of table categories, no sharding key by default
+	GlobalShardingKeys = map[string]string{}
+	//injected columns of table categories and tables
+	GlobalInjectedColumns = map[string][]Column{
+		"BASE":         {{Name: "UpdateTime", Type: "uint64", Position: "tail"}},
+		"BaseAccounts": {{Name: "AddTime", Type: "uint64", Position: "tail"}, {Name: "UpdateTime", Type: "uint64", Position: "tail"}},
+		"SPLIT":        {{Name: "UID", Type: "uint64", Position: "head", IsKey: true}, {Name: "UpdateTime", Type: "uint64", Position: "head"}},
+		"PUB":          {{Name: "UpdateTime", Type: "uint64", Position: "head"}},
+		"LIST":         {{Name: "UID", Type: "uint64", Position: "head", IsKey: true}, {Name: "UpdateTime", Type: "uint64", Position: "head"}},
+		"BLOB":         {{Name: "UID", Type: "uint64", Position: "head", IsKey: true}, {Name: "UpdateTime", Type: "uint64", Position: "head"}},
 	}
-	//blob proto files
-	GlobalBlobFiles = map[string]string{
-		"IN":  "blob_user_data_in.proto",
-		"OUT": "blob_user_data_out.proto",
+	//default limits profile of tcaplusdb engine
+	GlobalLimits = Limits{
+		MaxKeyFields:       4,
+		MaxIndexNum:        4,
+		MaxFields:          256,
+		MaxListNum:         10000,
+		KeyFieldTypes:      []string{"int32", "uint32", "int64", "uint64", "sint32", "sint64", "fixed32", "fixed64", "sfixed32", "sfixed64", "string"},
+		ReservedFieldNames: []string{},
 	}
+	//name prefixes of split messages
+	GlobalSplitMessagePrefixes = []string{"OUT_", "IN_"}
+	//name prefixes of pub messages
+	GlobalPubMessagePrefixes = []string{"PUB_"}
+	//candidate names of entity key field
+	GlobalEntityKeyNames = []string{"UUID"}
+	//allowed types of entity key field, empty means any type as entity key was matched by name only
+	GlobalEntityKeyTypes = []string{}
+	//acronyms of naming policy
+	GlobalNamingAcronyms = []string{"ID", "UID", "UUID", "GUID", "URL", "IP"}
 	//import paths for ignoring, not parse
 	GlobalIgnoreImportPaths = []string{
 		"proto/entity/common.proto",
 		"proto/entity/enumm_entity.proto",
 	}
 )
+//default values of config items
+const (
+	GlobalTcaplusPackageName = "tcaplus_entity"
+	GlobalTcaplusImportName  = "tcaplusservice.optionv1.proto"
+	GlobalBlobUserInMsg      = "blob_user_data_in"
+	GlobalBlobUserOutMsg     = "blob_user_data_out"
+	GlobalListMessagePrefix  = "LIST_"
+	GlobalListMaxNum         = 1000
+	GlobalEntityMarkerType   = "EntityType"
+	GlobalNamingPolicy       = "title"
+	GlobalLockFile           = "proto_parse.lock"
+)
+
 var (
 	//business variables
 	//base tables, read item `base_tables` from config file , if not exist in config file, assigned by default `GlobalBaseTables`
@@ -37,8 +83,16 @@ var (
 	BaseTableMap map[string]string
 	//base, pub and split proto files map, read item `pub_split_proto_files` from config file, if not exist in config file, assigned by default `GlobalPubSplitProtoFiles`
 	TableFiles map[string]string
-	//blob proto files map, read item `blob_proto_files` from config file, if not exist in config file, assigned by default `GlobalBlobFiles`
+	//blob categories, read item `blob_proto_files` from config file, if not exist in config file, assigned by default `GlobalBlobCategories`
+	BlobCategories []BlobCategory
+	//blob proto files map, key: blob category name, value: blob proto file, built from `BlobCategories`
 	BlobFiles map[string]string
+	//sharding keys map of table categories (BASE, PUB, SPLIT, BLOB), read item `sharding_keys` from config file, if not exist in config file, assigned by default `GlobalShardingKeys`
+	ShardingKeys map[string]string
+	//sharding keys map of specified tables, read item `table_sharding_keys` from config file, overrides the sharding key of table category
+	TableShardingKeys map[string]string
+	//injected columns map of table categories and tables, read section `injected_columns` from config file, if not exist in config file, assigned by default `GlobalInjectedColumns`
+	InjectedColumns map[string][]Column
 	//import paths for ignoring, read item `import_path_ignores` from config file, if not exist in config file, assigned by default `GlobalIgnoreImportPaths`
 	IgnoreImportPaths []string
 )
@@ -46,9 +100,11 @@ var (
 var (
 	//tcaplusdb constants
 	//tcaplusdb entity package name, read item `tcaplus_package_name` from config file, if not exist in config, assigned by default
-	TcaplusPackageName string = "tcaplus_entity"
+	TcaplusPackageName string = GlobalTcaplusPackageName
 	//tcaplusdb import path, read item `tcaplus_import_path` from config file, if not exist in config, assigned by default
-	TcaplusImportName string = "tcaplusservice.optionv1.proto"
+	TcaplusImportName string = GlobalTcaplusImportName
+	//limits of tcaplusdb engine, read section `limits` from config file, if not exist in config, assigned by default `GlobalLimits`
+	TcaplusLimits Limits = GlobalLimits
 )
 
 var (
@@ -57,12 +113,53 @@ var (
 	//business entity package name
 	CustomPackageName string = "entity"
 	//blob message name, read item `blob_user_in_msg_name` from config file, if not exist in config, assigned by default
-	BlobUserInMsg string = "blob_user_data_in"
+	BlobUserInMsg string = GlobalBlobUserInMsg
 	//blob message name, read item `blob_user_out_msg_name` from config file, if not exist in config, assigned by default
-	BlobUserOutMsg string = "blob_user_data_out"
+	BlobUserOutMsg string = GlobalBlobUserOutMsg
+	//list message prefix, read item `list_message_prefix` from config file, if not exist in config, assigned by default
+	ListMessagePrefix string = GlobalListMessagePrefix
+	//max element num of list table, read item `list_max_num` from config file, if not exist in config, assigned by default
+	ListMaxNum int = GlobalListMaxNum
+	//max element num of specified list tables, read item `list_table_max_nums` from config file, overrides `ListMaxNum`
+	ListTableMaxNums = map[string]int{}
+	//name prefixes of split messages, read item `split_message_prefixes` from config file, if not exist in config, assigned by default `GlobalSplitMessagePrefixes`
+	SplitMessagePrefixes = GlobalSplitMessagePrefixes
+	//name prefixes of pub messages, read item `pub_message_prefixes` from config file, if not exist in config, assigned by default `GlobalPubMessagePrefixes`
+	PubMessagePrefixes = GlobalPubMessagePrefixes
+	//prefixes stripped from table names, read item `strip_prefixes` of section `table_names` from config file
+	TableNameStripPrefixes = []string{}
+	//regex rewrites of table names applied in order, read item `rewrites` of section `table_names` from config file
+	TableNameRewrites = []NameRewrite{}
+	//explicit renames of tables, key: source message or blob table name, value: table name
+	//read item `renames` of section `table_names` from config file
+	TableNameRenames = map[string]string{}
+	//type of entity marker field, message with the marker is a table message, read item `entity_marker_type` from config file
+	EntityMarkerType string = GlobalEntityMarkerType
+	//candidate names of entity key field, read item `entity_key_names` from config file, if not exist in config, assigned by default `GlobalEntityKeyNames`
+	EntityKeyNames = GlobalEntityKeyNames
+	//allowed types of entity key field, read item `entity_key_types` from config file, empty means any type
+	//if not exist in config, assigned by default `GlobalEntityKeyTypes`
+	EntityKeyTypes = GlobalEntityKeyTypes
+	//table categories keeping the field numbers of source messages, BASE or LIST, read item `preserve_field_numbers` from config file
+	//the field number of removed EntityType field is reserved, and head columns are put behind all fields
+	PreserveFieldNumbers = []string{}
+	//naming policy of generated table names, field names and injected columns, read item `naming_policy` from config file
+	//one of preserve, title, PascalCase, snake_case, lowerCamel, if not exist in config, assigned by default
+	NamingPolicy string = GlobalNamingPolicy
+	//acronyms kept in upper case by PascalCase and lowerCamel naming policies, read item `naming_acronyms` from config file
+	//if not exist in config, assigned by default `GlobalNamingAcronyms`
+	NamingAcronyms = GlobalNamingAcronyms
+	//lock file in destination path saving stable states between runs, such as messages of split blob tables
+	//read item `lock_file` from config file, if not exist in config, assigned by default
+	LockFile string = GlobalLockFile
 	//specifiy proto files for ignoring parsing, read item `proto_file_ignores` from config file, if not exist in config, assigned by default
 	IgnoreProtoFiles string = ""
 
+	//message option for classifying message in source proto, such as `option (tcaplus.table) = {kind: SPLIT, keys: "UUID,UID"};`
+	TableAnnotation string = "(tcaplus.table)"
+	//message option for marking list message in source proto, value is the max element num of list table
+	ListAnnotation string = "(tcaplus.list_num)"
+
 	CommonProtoFile string = "common.proto"
 	EnumProtoFile   string = "enumm_entity.proto"
 	ProtoDataTypes         = []string{"int", "int32", "uint32", "int64", "uint64", "long", "bool", "double", "float", "string"}
@@ -116,6 +213,56 @@ type Map struct {
 	Field   Field
 }
 
+//limits of tcaplusdb engine, generated tables are validated against the limits
+type Limits struct {
+	//max number of primary key fields
+	MaxKeyFields int
+	//max number of indexes
+	MaxIndexNum int
+	//max number of fields
+	MaxFields int
+	//max element num of list table
+	MaxListNum int
+	//allowed types of primary key fields
+	KeyFieldTypes []string
+	//field names reserved by tcaplusdb
+	ReservedFieldNames []string
+}
+
+//blob category, blob messages with the prefix are saved as bytes columns of the blob table
+type BlobCategory struct {
+	//category name, such as IN, OUT, SOCIAL
+	Name string
+	//message name prefix, such as IN_, OUT_, SOCIAL_
+	Prefix string
+	//blob table name, such as BlobUserDataIn
+	Table string
+	//blob proto file, such as blob_user_data_in.proto
+	File string
+	//primary keys of blob table, the key columns of injected columns are used if not specified
+	Keys []string
+	//max column num of blob table, blob table is split into several tables if exceeded, 0 means no limit
+	MaxColumns int
+	//max estimated record size in bytes of blob table, blob table is split into several tables if exceeded, 0 means no limit
+	MaxSize int
+}
+
+//regex rewrite of table name, such as `^Base(.*)$ => $1`
+type NameRewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+//column injected into generated table, such as UID, UpdateTime
+type Column struct {
+	Name string
+	Type string
+	//head: in front of source fields (behind UUID if exists), tail: behind source fields
+	Position string
+	//whether the column is part of primary key
+	IsKey bool
+}
+
 type Field struct {
 	ID         int
 	Name       string
@@ -123,3 +270,38 @@ type Field struct {
 	IsRepeated bool
 	Options    []Option
 }
+
+//reset config items to default values before config file is parsed, so that parsing config file again gives the same result as a fresh run
+//items not in config file keep default values, such as in watch mode after an item is removed
+func ResetConfig() {
+	BaseTables = nil
+	BaseTableMap = map[string]string{}
+	TableFiles = map[string]string{}
+	BlobCategories = nil
+	BlobFiles = map[string]string{}
+	ShardingKeys = GlobalShardingKeys
+	TableShardingKeys = map[string]string{}
+	InjectedColumns = GlobalInjectedColumns
+	IgnoreImportPaths = nil
+	TcaplusPackageName = GlobalTcaplusPackageName
+	TcaplusImportName = GlobalTcaplusImportName
+	TcaplusLimits = GlobalLimits
+	BlobUserInMsg = GlobalBlobUserInMsg
+	BlobUserOutMsg = GlobalBlobUserOutMsg
+	ListMessagePrefix = GlobalListMessagePrefix
+	ListMaxNum = GlobalListMaxNum
+	ListTableMaxNums = map[string]int{}
+	SplitMessagePrefixes = GlobalSplitMessagePrefixes
+	PubMessagePrefixes = GlobalPubMessagePrefixes
+	TableNameStripPrefixes = []string{}
+	TableNameRewrites = []NameRewrite{}
+	TableNameRenames = map[string]string{}
+	EntityMarkerType = GlobalEntityMarkerType
+	EntityKeyNames = GlobalEntityKeyNames
+	EntityKeyTypes = GlobalEntityKeyTypes
+	PreserveFieldNumbers = []string{}
+	NamingPolicy = GlobalNamingPolicy
+	NamingAcronyms = GlobalNamingAcronyms
+	LockFile = GlobalLockFile
+	IgnoreProtoFiles = ""
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tencentyun/proto-parse-tcaplus/tools"
+)
+
+//lines of context in unified diff
+const diffContext int = 3
+
+//output unified diff between files generated by dry run and existing files in destination path
+//the number of files would be changed is returned
+func outputDryRunDiff(dstPath string) (int, error) {
+	var files []string
+	for file := range generatedFiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	changed := 0
+	for _, file := range files {
+		name, err := filepath.Rel(dstPath, file)
+		if err != nil {
+			name = file
+		}
+		oldName := "a/" + name
+		old, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			oldName = "/dev/null"
+		} else if err != nil {
+			return changed, fmt.Errorf("read %s error: %v", file, err)
+		}
+		diff := tools.UnifiedDiff(string(old), string(generatedFiles[file]), oldName, "b/"+name, diffContext)
+		if diff == "" {
+			continue
+		}
+		changed = changed + 1
+		fmt.Print(diff)
+	}
+	if changed == 0 {
+		fmt.Println("no generated files would change")
+	} else {
+		fmt.Printf("%d generated files would change\n", changed)
+	}
+	return changed, nil
+}
+
+//check whether generated files are kept in memory instead of written
+func writeNothing() bool {
+	return dryRun || checkOutputs
+}
+
+//compare files generated in memory with files in destination path
+//changed and missing files are stale, files in destination path not generated are extra, the number of stale files is returned
+func outputCheckResults(dstPath string) (int, error) {
+	var files []string
+	for file := range generatedFiles {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	stale := 0
+	for _, file := range files {
+		old, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			fmt.Printf("[MISSING] %s\n", file)
+			stale = stale + 1
+			continue
+		}
+		if err != nil {
+			return stale, fmt.Errorf("read %s error: %v", file, err)
+		}
+		if !bytes.Equal(old, generatedFiles[file]) {
+			fmt.Printf("[CHANGED] %s\n", file)
+			stale = stale + 1
+		}
+	}
+	infos, err := ioutil.ReadDir(dstPath)
+	if err != nil && !os.IsNotExist(err) {
+		return stale, fmt.Errorf("read %s error: %v", dstPath, err)
+	}
+	for _, info := range infos {
+		file := filepath.Join(dstPath, info.Name())
+		if _, ok := generatedFiles[file]; !ok && !info.IsDir() {
+			fmt.Printf("[EXTRA] %s\n", file)
+		}
+	}
+	if stale == 0 {
+		fmt.Println("generated files are up to date")
+	} else {
+		fmt.Printf("%d generated files are out of date, run convert to update them\n", stale)
+	}
+	return stale, nil
+}
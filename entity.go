@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//check whether field is entity marker, such as `EntityType dType = 1;`, package qualified type also matches
+func isEntityMarker(field comm.Field) bool {
+	return field.Type == comm.EntityMarkerType || strings.HasSuffix(field.Type, "."+comm.EntityMarkerType)
+}
+
+//check whether field is entity key, such as `uint64 UUID = 2;`, both the name and the type must be allowed
+func isEntityKey(field comm.Field) bool {
+	return containsString(comm.EntityKeyNames, field.Name) && isEntityKeyType(field.Type)
+}
+
+func isEntityKeyType(ftype string) bool {
+	return len(comm.EntityKeyTypes) == 0 || containsString(comm.EntityKeyTypes, ftype)
+}
+
+//get entity key field name of message, empty string returned if no entity key
+func entityKeyName(msg comm.Message) string {
+	for _, field := range msg.Fields {
+		if isEntityKey(field) {
+			return field.Name
+		}
+	}
+	return ""
+}
+
+//report fields and messages almost matching entity marker and entity key, the results are warnings
+func entityNearMatches(msg comm.Message, class msgClass) []string {
+	var ret []string
+	//fields like entity key, only reported for message with entity marker but no entity key
+	var keyLikes []string
+	markerIdx, keyIdx := -1, -1
+	for i, field := range msg.Fields {
+		if isEntityMarker(field) {
+			if markerIdx < 0 {
+				markerIdx = i
+			}
+			continue
+		}
+		if isEntityKey(field) {
+			if keyIdx < 0 {
+				keyIdx = i
+			}
+			continue
+		}
+		if strings.EqualFold(field.Type, comm.EntityMarkerType) {
+			ret = append(ret, fmt.Sprintf("field %s type %s looks like entity marker %s", field.Name, field.Type, comm.EntityMarkerType))
+		}
+		for _, key := range comm.EntityKeyNames {
+			if field.Name == key {
+				keyLikes = append(keyLikes, fmt.Sprintf("key field %s type %s is not one of entity_key_types", field.Name, field.Type))
+			} else if strings.EqualFold(field.Name, key) {
+				keyLikes = append(keyLikes, fmt.Sprintf("field %s looks like entity key %s", field.Name, key))
+			}
+		}
+	}
+	if markerIdx >= 0 && keyIdx < 0 {
+		ret = append(ret, keyLikes...)
+	}
+	if markerIdx >= 0 && keyIdx >= 0 && keyIdx < markerIdx {
+		ret = append(ret, fmt.Sprintf("key field %s is in front of entity marker, it is not taken as entity key", msg.Fields[keyIdx].Name))
+	}
+	if class.kind == "COMM" && hasTablePrefix(msg.Name) {
+		if markerIdx >= 0 && keyIdx < 0 {
+			ret = append(ret, fmt.Sprintf("message has entity marker %s but no entity key %s", comm.EntityMarkerType, strings.Join(comm.EntityKeyNames, " or ")))
+		} else if markerIdx < 0 && keyIdx >= 0 {
+			ret = append(ret, fmt.Sprintf("message has entity key %s but no entity marker %s", msg.Fields[keyIdx].Name, comm.EntityMarkerType))
+		}
+	}
+	return ret
+}
+
+//check whether message name has the prefix of split or pub messages
+func hasTablePrefix(name string) bool {
+	if _, ok := matchPrefix(name, comm.SplitMessagePrefixes); ok {
+		return true
+	}
+	_, ok := matchPrefix(name, comm.PubMessagePrefixes)
+	return ok
+}
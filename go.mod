@@ -1,11 +1,12 @@
 module github.com/tencentyun/proto-parse-tcaplus
 
-go 1.15
+go 1.16
 
 require (
 	github.com/emicklei/proto v1.9.0
 	github.com/golang/protobuf v1.4.3
 	github.com/spf13/cobra v1.1.1
 	github.com/stretchr/testify v1.3.0
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/ini.v1 v1.62.0
 )
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//get proto file and table which message is generated to, empty strings returned if message is not generated to table
+//blob message is a column of blob table, other table message is the source of its table
+func messageTable(name string) (string, string) {
+	for file, ts := range tables {
+		for _, t := range ts {
+			if t.source == name {
+				return file, t.msg.Name
+			}
+			if t.category != "BLOB" {
+				continue
+			}
+			for _, source := range t.fieldSources {
+				if source == name {
+					return file, t.msg.Name
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+//output classification of each source message, and the table and proto file it is generated to
+func outputClassifications() {
+	var names []string
+	for name := range msgClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		class := msgClasses[name]
+		line := fmt.Sprintf("%s: %s by %s", name, kindString(class), class.rule)
+		if file, table := messageTable(name); table != "" {
+			line = fmt.Sprintf("%s -> %s (%s)", line, table, file)
+		}
+		fmt.Println(line)
+	}
+	for _, warn := range warnInfos {
+		fmt.Println(fmt.Sprintf("[WARNING] %v", warn))
+	}
+}
+
+//result of checking a classification rule against message
+type ruleCheck struct {
+	rule    string
+	matched bool
+	reason  string
+}
+
+//describe entity marker and entity key fields of message in the order checkMessageFlag reads them
+//the flag is 2 if entity marker is followed by entity key, 1 if only one of them is found first, 0 if none
+func entityFields(msg comm.Message) (int, string) {
+	var marker, key string
+	for _, field := range msg.Fields {
+		if isEntityMarker(field) {
+			marker = field.Name
+			continue
+		}
+		if isEntityKey(field) {
+			key = field.Name
+			break
+		}
+	}
+	keyNames := strings.Join(comm.EntityKeyNames, " or ")
+	switch {
+	case marker != "" && key != "":
+		return 2, fmt.Sprintf("entity marker %s followed by entity key %s", marker, key)
+	case marker != "":
+		return 1, fmt.Sprintf("entity marker %s without entity key %s after it", marker, keyNames)
+	case key != "":
+		return 1, fmt.Sprintf("entity key %s without entity marker %s in front of it", key, comm.EntityMarkerType)
+	}
+	return 0, fmt.Sprintf("no entity marker %s or entity key %s", comm.EntityMarkerType, keyNames)
+}
+
+//check each classification rule against message in the order of classifyMessage, the first matched naming rule decides the kind
+//table annotation takes precedence over naming rules
+func checkRules(msg comm.Message) []ruleCheck {
+	flag, entity := entityFields(msg)
+	var checks []ruleCheck
+
+	annotation := ruleCheck{rule: fmt.Sprintf("%s annotation", comm.TableAnnotation), reason: "no annotation"}
+	if opt, ok := tableAnnotation(msg); ok {
+		if class, err := classifyByAnnotation(msg, opt); err != nil {
+			annotation.reason = fmt.Sprintf("annotation error: %v", err)
+		} else {
+			annotation.matched = true
+			annotation.reason = fmt.Sprintf("annotated as %s, takes precedence over naming rules", kindString(class))
+		}
+	}
+	checks = append(checks, annotation)
+
+	list := ruleCheck{rule: "list rule"}
+	if _, ok := listAnnotation(msg); ok {
+		list.matched, list.reason = true, fmt.Sprintf("has %s annotation", comm.ListAnnotation)
+	} else if comm.ListMessagePrefix == "" || !strings.HasPrefix(msg.Name, comm.ListMessagePrefix) {
+		list.reason = fmt.Sprintf("no %s annotation, and name has no prefix %s", comm.ListAnnotation, comm.ListMessagePrefix)
+	} else if !hasEntityTypeField(msg) {
+		list.reason = fmt.Sprintf("name has prefix %s, but no entity marker %s", comm.ListMessagePrefix, comm.EntityMarkerType)
+	} else {
+		list.matched, list.reason = true, fmt.Sprintf("name has prefix %s and entity marker %s", comm.ListMessagePrefix, comm.EntityMarkerType)
+	}
+	checks = append(checks, list)
+
+	blob := ruleCheck{rule: "blob rule"}
+	var blobPrefixes []string
+	for _, cat := range comm.BlobCategories {
+		blobPrefixes = append(blobPrefixes, cat.Prefix)
+	}
+	if cat, ok := blobCategoryOfName(msg.Name); !ok {
+		blob.reason = fmt.Sprintf("name has no prefix of blob categories (%s)", strings.Join(blobPrefixes, ", "))
+	} else if flag != 1 {
+		blob.reason = fmt.Sprintf("name has prefix %s of blob category %s, but has %s, blob message needs only one of them", cat.Prefix, cat.Name, entity)
+	} else {
+		blob.matched, blob.reason = true, fmt.Sprintf("name has prefix %s of blob category %s, and has %s", cat.Prefix, cat.Name, entity)
+	}
+	checks = append(checks, blob)
+
+	for _, rule := range []struct {
+		name     string
+		item     string
+		prefixes []string
+	}{
+		{"split rule", "split_message_prefixes", comm.SplitMessagePrefixes},
+		{"pub rule", "pub_message_prefixes", comm.PubMessagePrefixes},
+	} {
+		check := ruleCheck{rule: rule.name}
+		if prefix, ok := matchPrefix(msg.Name, rule.prefixes); !ok {
+			check.reason = fmt.Sprintf("name has no prefix of %s (%s)", rule.item, strings.Join(rule.prefixes, ", "))
+		} else if flag != 2 {
+			check.reason = fmt.Sprintf("name has prefix %s, but has %s", prefix, entity)
+		} else {
+			check.matched, check.reason = true, fmt.Sprintf("name has prefix %s, and has %s", prefix, entity)
+		}
+		checks = append(checks, check)
+	}
+
+	base := ruleCheck{rule: "base_tables config", reason: "not listed in base_tables"}
+	if isBaseMessageType(msg) {
+		base.matched, base.reason = true, "listed in base_tables"
+	}
+	checks = append(checks, base)
+	return checks
+}
+
+//get list annotation of message, such as `option (tcaplus.list_num) = 1000;`
+func listAnnotation(msg comm.Message) (comm.Option, bool) {
+	for _, opt := range msg.Options {
+		if opt.Name == comm.ListAnnotation {
+			return opt, true
+		}
+	}
+	return comm.Option{}, false
+}
+
+//find generated table of message, blob message is a column of blob table
+func findTable(name string) (table, bool) {
+	for _, ts := range tables {
+		for _, t := range ts {
+			if t.source == name {
+				return t, true
+			}
+		}
+	}
+	for _, ts := range tables {
+		for _, t := range ts {
+			if t.category == "BLOB" && generatedField(t, name) != nil {
+				return t, true
+			}
+		}
+	}
+	return table{}, false
+}
+
+//get generated field of source, nil returned if source is not generated
+func generatedField(t table, source string) *comm.Field {
+	for i, field := range t.msg.Fields {
+		if t.fieldSources[field.Name] == source {
+			return &t.msg.Fields[i]
+		}
+	}
+	return nil
+}
+
+func fieldString(field comm.Field) string {
+	if field.IsRepeated {
+		return fmt.Sprintf("repeated %s %s = %d", field.Type, field.Name, field.ID)
+	}
+	return fmt.Sprintf("%s %s = %d", field.Type, field.Name, field.ID)
+}
+
+//output how message is classified, the rules matched and not matched, and what each field is generated to
+func outputMessageExplanation(name string) error {
+	class, ok := msgClasses[name]
+	msg, found := findMessage(name)
+	if !ok || !found {
+		return fmt.Errorf("message %s not found in source proto files, nested messages are not classified", name)
+	}
+	file, tableName := messageTable(name)
+	fmt.Printf("Message: %s\n", name)
+	fmt.Printf("Category: %s by %s\n", kindString(class), class.rule)
+
+	fmt.Println("Rules:")
+	decided := false
+	for _, check := range checkRules(msg) {
+		switch {
+		case check.matched && !decided:
+			decided = true
+			fmt.Printf("  %s: matched, %s\n", check.rule, check.reason)
+		case check.matched:
+			fmt.Printf("  %s: matched but not used, %s, the rule above takes precedence\n", check.rule, check.reason)
+		default:
+			fmt.Printf("  %s: not matched, %s\n", check.rule, check.reason)
+		}
+	}
+	if !decided {
+		fmt.Println("  default rule: matched, no rule above matches, message is not a table")
+	}
+
+	t, generated := findTable(name)
+	fmt.Println("Fields:")
+	for _, field := range msg.Fields {
+		source := fieldString(field)
+		if isEntityMarker(field) {
+			fmt.Printf("  %s: entity marker, not generated\n", source)
+			continue
+		}
+		newType, kind, ok := resolveFieldType(field.Type, msg)
+		line := fmt.Sprintf("  %s: %s type, resolved to %s", source, kind, newType)
+		if !ok {
+			line = fmt.Sprintf("  %s: unresolved type, generated as is", source)
+		}
+		if generated && t.category != "BLOB" {
+			if f := generatedField(t, fmt.Sprintf("%s.%s", name, field.Name)); f != nil {
+				line = fmt.Sprintf("%s -> %s", line, fieldString(*f))
+			} else {
+				line = line + " -> not generated"
+			}
+		}
+		fmt.Println(line)
+	}
+	for _, mapf := range msg.Maps {
+		line := fmt.Sprintf("  map<%s, %s> %s = %d: map type, resolved to bytes", mapf.KeyType, mapf.Field.Type, mapf.Field.Name, mapf.Field.ID)
+		if generated && t.category != "BLOB" {
+			if f := generatedField(t, fmt.Sprintf("%s.%s", name, mapf.Field.Name)); f != nil {
+				line = fmt.Sprintf("%s -> %s", line, fieldString(*f))
+			}
+		}
+		fmt.Println(line)
+	}
+
+	if !generated {
+		fmt.Println("Output: not generated to table, fields of its type are generated as bytes")
+	} else if t.category == "BLOB" {
+		fmt.Printf("Output: column %s of blob table %s (%s)\n", fieldString(*generatedField(t, name)), tableName, file)
+	} else {
+		var injected []string
+		for _, field := range t.msg.Fields {
+			if t.fieldSources[field.Name] == injectedSource {
+				injected = append(injected, fieldString(field))
+			}
+		}
+		if len(injected) > 0 {
+			fmt.Printf("Injected columns: %s\n", strings.Join(injected, ", "))
+		}
+		for _, opt := range t.msg.Options {
+			if opt.Name == primaryKeyOption {
+				fmt.Printf("Primary key: %s\n", opt.Value)
+			}
+		}
+		fmt.Printf("Output: table %s (%s)\n", tableName, file)
+	}
+
+	pattern := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	for _, warn := range warnInfos {
+		if pattern.MatchString(warn) {
+			fmt.Println(fmt.Sprintf("[WARNING] %v", warn))
+		}
+	}
+	return nil
+}
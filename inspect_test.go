@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//get standard output of f
+func captureOutput(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	f()
+	assert.NoError(t, w.Close())
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+//build tables like inspect command, the lock file in destination path is read if specified
+func inspectForTest(t *testing.T, srcPath string, dstPath string) {
+	resetParseState()
+	cfgFile = "config/proto_parse.cfg"
+	assert.NoError(t, loadConfig())
+	assert.NoError(t, ProtoParseAndBuild(srcPath, dstPath, comm.IgnoreProtoFiles))
+}
+
+func TestOutputMessageExplanation(t *testing.T) {
+	inspectForTest(t, "testdata/test", "")
+	cases := []struct {
+		name  string
+		lines []string
+	}{
+		{"OUT_Pet", []string{
+			"Category: SPLIT by split rule",
+			"  blob rule: not matched, name has prefix OUT_ of blob category OUT, but has entity marker dType followed by entity key UUID, blob message needs only one of them",
+			"  split rule: matched, name has prefix OUT_, and has entity marker dType followed by entity key UUID",
+			"  EntityType dType = 1: entity marker, not generated",
+			"  PetList list = 9: message type, resolved to bytes -> bytes List = 10",
+			"Injected columns: uint64 UID = 2, uint64 UpdateTime = 3",
+			"Primary key: UUID,UID",
+			"Output: table OUT_Pet (table_split_message.proto)",
+		}},
+		{"OUT_ChaosBattle", []string{
+			"Category: BLOB(OUT) by blob rule",
+			"  blob rule: matched, name has prefix OUT_ of blob category OUT, and has entity marker dType without entity key UUID after it",
+			"  uint32 killNum = 3: scalar type, resolved to uint32",
+			"Output: column bytes OUT_ChaosBattle = 3 of blob table BlobUserDataOut (blob_user_data_out.proto)",
+		}},
+		{"BaseAccounts", []string{
+			"Category: BASE by base_tables config",
+			"  base_tables config: matched, listed in base_tables",
+			"Output: table BaseAccounts (base.proto)",
+		}},
+	}
+	for _, c := range cases {
+		var err error
+		out := captureOutput(t, func() { err = outputMessageExplanation(c.name) })
+		assert.NoError(t, err, c.name)
+		assert.True(t, strings.HasPrefix(out, "Message: "+c.name+"\n"), out)
+		for _, line := range c.lines {
+			assert.Contains(t, strings.Split(out, "\n"), line, c.name)
+		}
+	}
+
+	assert.Error(t, outputMessageExplanation("Nope"))
+}
+
+func TestInspectReadsLock(t *testing.T) {
+	configSets = []string{"blob_max_columns=OUT:3"}
+	defer func() { configSets = nil }()
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	editFile(t, filepath.Join(src, "chaos_battle.proto"), func(s string) string {
+		return strings.Replace(s, "message OUT_ChaosBattle {", "message OUT_Arena {\n    EntityType dType = 1;\n    uint32 score = 2;\n}\nmessage OUT_ChaosBattle {", 1)
+	})
+
+	//blob table of message is assigned by the lock in destination path, the same as convert
+	for _, c := range []struct {
+		dstPath string
+		table   string
+	}{{dst, "BlobUserDataOut_1"}, {"", "BlobUserDataOut_2"}} {
+		inspectForTest(t, src, c.dstPath)
+		out := captureOutput(t, func() { assert.NoError(t, outputMessageExplanation("OUT_ChaosBattle")) })
+		assert.Contains(t, out, "of blob table "+c.table+" ", "dest path: %s", c.dstPath)
+	}
+}
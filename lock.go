@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//states saved in lock file, keep generated tables stable between runs
+type lockInfo struct {
+	//messages of split blob tables, key: blob category name, value: blob messages of each blob table in order
+	BlobTables map[string][][]string `json:"blob_tables,omitempty"`
+	//columns and reserved entries of generated tables, key: table name
+	Tables map[string]lockTable `json:"tables,omitempty"`
+}
+
+//lock states read from lock file of previous run, and updated by current run
+var lock = lockInfo{BlobTables: map[string][][]string{}, Tables: map[string]lockTable{}}
+
+//read lock file in destination path, nothing read if lock file not exist or no destination path
+func readLockFile(dstPath string) error {
+	l, err := loadLock(dstPath)
+	if err != nil {
+		return err
+	}
+	lock = l
+	return nil
+}
+
+//load lock file in path, empty states returned if lock file not exist or no path
+func loadLock(dir string) (lockInfo, error) {
+	l := lockInfo{BlobTables: map[string][][]string{}, Tables: map[string]lockTable{}}
+	if dir == "" {
+		return l, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, comm.LockFile))
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return l, fmt.Errorf("read lock file error: %v", err)
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return l, fmt.Errorf("parse lock file %s error: %v", comm.LockFile, err)
+	}
+	if l.BlobTables == nil {
+		l.BlobTables = map[string][][]string{}
+	}
+	if l.Tables == nil {
+		l.Tables = map[string]lockTable{}
+	}
+	return l, nil
+}
+
+//write lock file into destination path, lock file is not written if no states to save
+func writeLockFile(dstPath string) error {
+	if len(lock.BlobTables) == 0 && len(lock.Tables) == 0 {
+		return nil
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("write lock file error: %v", err)
+	}
+	lockPath := filepath.Join(dstPath, comm.LockFile)
+	if writeNothing() {
+		generatedFiles[lockPath] = append(data, '\n')
+		return nil
+	}
+	if err := ioutil.WriteFile(lockPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write lock file error: %v", err)
+	}
+	fmt.Printf("Generated lock: %s\n", lockPath)
+	return nil
+}
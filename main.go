@@ -2,54 +2,513 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 
 	"github.com/tencentyun/proto-parse-tcaplus/comm"
 
 	"github.com/spf13/cobra"
 	"github.com/tencentyun/proto-parse-tcaplus/tools"
+	"gopkg.in/ini.v1"
 )
 
-func parseArgs() {
-	var protoSrcPath, protoDstPath string
-	var cfgFile string
-	var rootCmd = &cobra.Command{
-		Use:     "proto-parse-tcaplus",
-		Short:   "Parse business proto files and write to new proto files for TcaplusDB",
-		Long:    "Parse business proto files and write to new proto files for TcaplusDB ",
-		Example: `  ./proto-parse-tcaplus -s "./testdata/test" -d "./out/test"  -c "./config/proto_parse.cfg`,
+//exit codes of commands
+const (
+	exitOK int = 0
+	//breaking changes found, generated files out of date, or records failed to migrate
+	exitFailed int = 1
+	//wrong command line arguments
+	exitUsage int = 2
+	//error stops the command, such as read error
+	exitError int = 3
+	//config file can not be read or has wrong items
+	exitConfig int = 4
+	//source proto files, lock file or previous proto files can not be parsed
+	exitParse int = 5
+	//proto file failed to convert, such as tables violate tcaplusdb limits, or warnings in strict mode
+	exitValidation int = 6
+	//generated files can not be written
+	exitWrite int = 7
+)
+
+//error with exit code, returned by the stages of conversion
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e codeError) Error() string {
+	return e.err.Error()
+}
+
+//attach exit code to error, nil returned if err is nil
+func withCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return codeError{code: code, err: err}
+}
+
+//get exit code of error, exitError returned if no exit code attached
+func errorCode(err error) int {
+	if e, ok := err.(codeError); ok {
+		return e.code
+	}
+	return exitError
+}
+
+//exit code of conversion results, write errors take precedence over validation errors
+func resultCode() int {
+	if !convertFailed() {
+		return exitOK
+	}
+	for _, errs := range fileErrors {
+		for _, e := range errs {
+			if e.Kind == errorWrite {
+				return exitWrite
+			}
+		}
+	}
+	return exitValidation
+}
+
+//flags shared by commands
+var (
+	protoSrcPath string
+	protoDstPath string
+	cfgFile      string
+	reportFormat string
+	reportFile   string
+	//config items overridden by --set, such as business.base_tables=BaseRoles
+	configSets []string
+	//sources of config items overridden by environment variables and --set
+	configSources map[string]string
+)
+
+//add source path flag, and destination path flag if dest is true
+func addPathFlags(cmd *cobra.Command, dest bool) {
+	cmd.Flags().StringVarP(&protoSrcPath, "source-path", "s", "", "source path of proto files")
+	if dest {
+		cmd.Flags().StringVarP(&protoDstPath, "dest-path", "d", "", "destination path of generated proto files")
+	}
+}
+
+//add report flags of parse results
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&reportFormat, "report", reportText, "format of parse results report: text or json")
+	cmd.Flags().StringVar(&reportFile, "report-file", "", "write json report into file instead of standard output")
+}
+
+//check report flags, output other than json report is redirected to standard error if json report is printed to standard output
+func setupReport(cmd *cobra.Command) {
+	if reportFormat != reportText && reportFormat != reportJSON {
+		fmt.Printf("unknown report format %s, should be text or json\n", reportFormat)
+		cmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if reportFormat == reportJSON && reportFile == "" {
+		os.Stdout = os.Stderr
+	}
+}
+
+//write json report if specified by --report
+func outputReport() error {
+	if reportFormat != reportJSON {
+		return nil
+	}
+	return writeReport(reportFile)
+}
+
+//read and parse config file specified by --config
+func loadConfig() error {
+	if cfgFile == "" {
+		return withCode(exitConfig, fmt.Errorf("config file not specified, use --config"))
+	}
+	_, err := loadConfigFile()
+	return err
+}
+
+//read config file with overrides of environment variables and --set, and parse it
+func loadConfigFile() (*ini.File, error) {
+	cfg, sources, err := tools.ReadIniWithOverrides(cfgFile, configSets)
+	if err != nil {
+		return nil, withCode(exitConfig, err)
+	}
+	configSources = sources
+	//parse config file
+	return cfg, withCode(exitConfig, tools.ParseCfg(cfg))
+}
+
+//print error and exit with code
+func exitWith(code int, err error) {
+	if err != nil {
+		fmt.Println(err)
+	}
+	os.Exit(code)
+}
+
+//check required flags, usage is printed and exit if any flag is empty
+func requireFlags(cmd *cobra.Command, flags ...string) {
+	for _, flag := range flags {
+		if cmd.Flags().Lookup(flag).Value.String() == "" {
+			fmt.Printf("flag --%s is required\n", flag)
+			cmd.Usage()
+			os.Exit(exitUsage)
+		}
+	}
+}
+
+//convert proto files and write generated proto files, compare with baseline if specified
+//the exit code is returned, parse results of previous run are reset so that it can run again in watch mode
+func convertOnce(baseline string, allowBreaking bool) (int, error) {
+	resetParseState()
+	//check dest path is existed or not, if not create. nothing is written in dry run or check mode
+	if !writeNothing() {
+		if err := tools.CreateDir(protoDstPath); err != nil {
+			return exitWrite, err
+		}
+	}
+	if err := loadConfig(); err != nil {
+		return errorCode(err), err
+	}
+	//baseline is loaded before generated files are written, as destination path may be the baseline
+	var baseSchema map[string]schemaTable
+	if baseline != "" {
+		var err error
+		if baseSchema, err = loadBaseline(baseline); err != nil {
+			return exitError, err
+		}
+	}
+	if err := ProtoParseAndWrite(protoSrcPath, protoDstPath, comm.IgnoreProtoFiles); err != nil {
+		if errorCode(err) != exitValidation {
+			return errorCode(err), err
+		}
+		//failed proto files are reported, though nothing is written
+		if err := outputReport(); err != nil {
+			return exitWrite, err
+		}
+		return exitValidation, err
+	}
+	if err := outputReport(); err != nil {
+		return exitWrite, err
+	}
+	code := resultCode()
+	//compare generated files with committed files in check mode
+	if checkOutputs {
+		stale, err := outputCheckResults(protoDstPath)
+		if err != nil {
+			return exitError, err
+		}
+		if stale > 0 && code == exitOK {
+			code = exitFailed
+		}
+	}
+	if baseline == "" {
+		return code, nil
+	}
+	//compare generated tables with baseline, breaking changes fail the conversion
+	breaking := CheckBaseline(baseline, baseSchema)
+	if breaking > 0 && !allowBreaking {
+		fmt.Printf("%d breaking changes against baseline, use --allow-breaking to allow them\n", breaking)
+		if code == exitOK {
+			code = exitFailed
+		}
+	}
+	return code, nil
+}
+
+//convert proto files and exit with the result, or convert on each change in watch mode
+func runConvert(baseline string, allowBreaking bool, watch bool) {
+	if !watch {
+		exitWith(convertOnce(baseline, allowBreaking))
+	}
+	watchAndRun(protoSrcPath, cfgFile, func() {
+		if code, err := convertOnce(baseline, allowBreaking); err != nil {
+			fmt.Println(err)
+		} else if code != exitOK {
+			fmt.Printf("convert failed, exit code %d\n", code)
+		}
+	})
+}
+
+func newConvertCmd() *cobra.Command {
+	var baseline string
+	var allowBreaking, watch bool
+	cmd := &cobra.Command{
+		Use:     "convert",
+		Short:   "Convert business proto files to proto files for TcaplusDB",
+		Long:    "Convert business proto files to proto files for TcaplusDB, exit with non-zero code if any proto file fails to convert, breaking changes are found against baseline, or generated files are out of date in check mode",
+		Example: `  ./proto-parse-tcaplus convert -s "./testdata/test" -d "./out/test" -c "./config/proto_parse.cfg"`,
+		Args:    cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			requireFlags(cmd, "source-path", "dest-path")
+			setupReport(cmd)
+			runConvert(baseline, allowBreaking, watch)
+		},
+	}
+	addPathFlags(cmd, true)
+	cmd.Flags().StringVar(&baseline, "baseline", "", "directory of baseline proto files, exit non-zero on breaking changes against it")
+	cmd.Flags().BoolVar(&allowBreaking, "allow-breaking", false, "allow breaking changes against baseline")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "write nothing, print unified diff between generated files and files in destination path")
+	cmd.Flags().BoolVar(&checkOutputs, "check", false, "write nothing, exit non-zero if any file in destination path would change or is missing")
+	cmd.Flags().BoolVar(&watch, "watch", false, "watch source path and config file, and convert again on changes")
+	addReportFlags(cmd)
+	cmd.Flags().BoolVar(&strictMode, "strict", false, "take warnings as failures, such as dropped options and unresolved types")
+	return cmd
+}
 
-			if protoSrcPath == "" || protoDstPath == "" || cfgFile == "" {
-				cmd.Help()
-				os.Exit(0)
+func newValidateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "validate",
+		Short:   "Validate business proto files without writing generated proto files",
+		Long:    "Classify business proto files and validate generated tables against TcaplusDB limits without writing them, exit with non-zero code if any proto file fails. The lock file and previous proto files of destination path are read if specified",
+		Example: `  ./proto-parse-tcaplus validate -s "./testdata/test" -c "./config/proto_parse.cfg"`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			requireFlags(cmd, "source-path")
+			setupReport(cmd)
+			if err := loadConfig(); err != nil {
+				exitWith(errorCode(err), err)
 			}
-			//check dest path is existed or not, if not create.
-			if err := tools.CreateDir(protoDstPath); err != nil {
-				fmt.Println(err)
-				os.Exit(-1)
+			//failed proto files are reported by parse results
+			if err := ProtoParseAndBuild(protoSrcPath, protoDstPath, comm.IgnoreProtoFiles); err != nil && errorCode(err) != exitValidation {
+				exitWith(errorCode(err), err)
 			}
-			//read config file
-			cfg, err := tools.ReadIni(cfgFile)
+			if err := outputParseResults(protoSrcPath, comm.IgnoreProtoFiles); err != nil {
+				exitWith(exitError, err)
+			}
+			if err := outputReport(); err != nil {
+				exitWith(exitWrite, err)
+			}
+			os.Exit(resultCode())
+		},
+	}
+	addPathFlags(cmd, true)
+	addReportFlags(cmd)
+	cmd.Flags().BoolVar(&strictMode, "strict", false, "take warnings as failures, such as dropped options and unresolved types")
+	return cmd
+}
+
+func newInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect [message-name]",
+		Short: "Show how business messages are classified and generated",
+		Long: "Show the classification of each business message, the rule which decides it, and the table and proto file it is generated to. " +
+			"If message name is specified, explain why each rule matches or not, and the resolved type of each field and what it is generated to. " +
+			"If destination path is specified, the lock file in it is read, so that messages are assigned to split blob tables and columns are numbered as convert does",
+		Example: `  ./proto-parse-tcaplus inspect -s "./testdata/test" -d "./out/test" -c "./config/proto_parse.cfg"
+  ./proto-parse-tcaplus inspect OUT_Pet -s "./testdata/test" -c "./config/proto_parse.cfg"`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			requireFlags(cmd, "source-path")
+			if err := loadConfig(); err != nil {
+				exitWith(errorCode(err), err)
+			}
+			//messages of failed proto files are inspected as well
+			if err := ProtoParseAndBuild(protoSrcPath, protoDstPath, comm.IgnoreProtoFiles); err != nil && errorCode(err) != exitValidation {
+				exitWith(errorCode(err), err)
+			}
+			if len(args) == 0 {
+				outputClassifications()
+				return
+			}
+			if err := outputMessageExplanation(args[0]); err != nil {
+				exitWith(exitError, err)
+			}
+		},
+	}
+	addPathFlags(cmd, true)
+	return cmd
+}
+
+func newInitCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:     "init",
+		Short:   "Write a config file template",
+		Long:    "Write a config file template to the path of --config, existing config file is not overwritten unless --force is specified. If --source-path is specified, the proto files are scanned, and candidate base tables and their key fields are written into the config with explanations",
+		Example: `  ./proto-parse-tcaplus init -c "./proto_parse.cfg" -s "./testdata/test"`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			requireFlags(cmd, "config")
+			if _, err := os.Stat(cfgFile); err == nil && !force {
+				exitWith(exitError, fmt.Errorf("%s already exists, use --force to overwrite it", cfgFile))
+			}
+			config := tools.ConfigTemplate(demoConfig)
+			if protoSrcPath != "" {
+				var err error
+				if config, err = scaffoldConfig(protoSrcPath); err != nil {
+					exitWith(errorCode(err), err)
+				}
+			}
+			if err := ioutil.WriteFile(cfgFile, []byte(config), 0644); err != nil {
+				exitWith(exitError, fmt.Errorf("write config file error: %v", err))
+			}
+			fmt.Printf("Generated config: %s\n", cfgFile)
+		},
+	}
+	addPathFlags(cmd, false)
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite existing config file")
+	return cmd
+}
+
+//scan source proto files with config template, and fill suggested base tables into config template
+//blob categories without blob messages are removed, as their blob proto files fail to convert
+func scaffoldConfig(srcPath string) (string, error) {
+	template := tools.ConfigTemplate(demoConfig)
+	tmpl, err := ini.Load([]byte(template))
+	if err != nil {
+		return "", err
+	}
+	if err := tools.ParseCfg(tmpl); err != nil {
+		return "", err
+	}
+	if err := traverseProtoFiles(srcPath, comm.IgnoreProtoFiles); err != nil {
+		return "", withCode(exitParse, err)
+	}
+	suggestions := suggestBaseTables()
+	outputSuggestions(srcPath, suggestions)
+	var baseTables []string
+	primaryKeys := map[string][]string{}
+	comments := []string{"base tables suggested by init from " + srcPath + ", review them before use"}
+	for _, s := range suggestions {
+		comments = append(comments, fmt.Sprintf("%s (%s): %s", s.name, s.file, s.reason))
+		if len(s.keys) > 0 {
+			baseTables = append(baseTables, s.name)
+			primaryKeys[s.name] = s.keys
+		}
+	}
+	blobCategories, removed := usedBlobCategories()
+	for _, name := range removed {
+		comment := fmt.Sprintf("blob category %s is removed from blob_proto_files, no blob message found", name)
+		fmt.Println("  " + comment)
+		comments = append(comments, comment)
+	}
+	return tools.ScaffoldConfig(template, baseTables, primaryKeys, blobCategories, comments), nil
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show config of the tool",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:     "print",
+		Short:   "Print effective config",
+		Long:    "Print effective config after applying defaults, config file, environment variables and --set in order, each item of business and tcaplusdb is commented with its source",
+		Example: `  PROTO_PARSE_TCAPLUS_LIST_MAX_NUM=500 ./proto-parse-tcaplus config print -c "./config/proto_parse.cfg" --set business.naming_policy=snake_case`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfigFile()
+			if err != nil {
+				exitWith(errorCode(err), err)
+			}
+			if _, err := tools.EffectiveConfig(cfg, configSources).WriteTo(os.Stdout); err != nil {
+				exitWith(exitError, err)
+			}
+		},
+	})
+	return cmd
+}
+
+func newDiffCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "diff <old-dest-path> <new-dest-path>",
+		Short:   "Compare two sets of generated proto files for TcaplusDB",
+		Long:    "Compare two sets of generated proto files for TcaplusDB, list table and field changes, and mark each change compatible or breaking, exit with 1 if any change is breaking",
+		Example: `  ./proto-parse-tcaplus diff "./out/release" "./out/test"`,
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			breaking, err := DiffSchemaDirs(args[0], args[1])
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(-1)
+				exitWith(exitError, err)
+			}
+			if breaking > 0 {
+				os.Exit(exitFailed)
 			}
-			//parse config file
-			err = tools.ParseCfg(cfg)
+		},
+	}
+}
+
+func newPlanCmd() *cobra.Command {
+	var planDir string
+	cmd := &cobra.Command{
+		Use:     "plan <old-dest-path> <new-dest-path>",
+		Short:   "Write migration plan between two sets of generated proto files for TcaplusDB",
+		Long:    "Write ordered migration plan between two sets of generated proto files for TcaplusDB, as markdown and json",
+		Example: `  ./proto-parse-tcaplus plan "./out/release" "./out/test" -o "./out"`,
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := tools.CreateDir(planDir); err != nil {
+				exitWith(exitError, err)
+			}
+			if err := WriteMigrationPlan(args[0], args[1], planDir); err != nil {
+				exitWith(exitError, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&planDir, "output", "o", ".", "output directory of migration plan")
+	return cmd
+}
+
+func newMigrateCmd() *cobra.Command {
+	var table, newTable, input, output, format string
+	cmd := &cobra.Command{
+		Use:     "migrate <old-dest-path> <new-dest-path>",
+		Short:   "Migrate records dumped from a table to new generated proto files for TcaplusDB",
+		Long:    "Migrate records dumped from a table of old generated proto files to the table of new generated proto files offline, fields are mapped by name, or by number if renamed",
+		Example: `  ./proto-parse-tcaplus migrate "./out/release" "./out/test" -t OUT_Pet -i "./pet.jsonl" -o "./pet_new.jsonl"`,
+		Args:    cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			requireFlags(cmd, "table", "input", "output")
+			failed, err := MigrateRecords(args[0], args[1], table, newTable, input, output, format)
 			if err != nil {
-				fmt.Println(err)
-				os.Exit(-1)
+				exitWith(exitError, err)
+			}
+			if failed > 0 {
+				os.Exit(exitFailed)
 			}
-			ProtoParseAndWrite(protoSrcPath, protoDstPath, comm.IgnoreProtoFiles)
 		},
 	}
+	cmd.Flags().StringVarP(&table, "table", "t", "", "table of dumped records")
+	cmd.Flags().StringVar(&newTable, "new-table", "", "table in new generated proto files, same as --table by default")
+	cmd.Flags().StringVarP(&input, "input", "i", "", "file of dumped records")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file of migrated records")
+	cmd.Flags().StringVarP(&format, "format", "f", recordJSON, "format of records: json (one record per line) or binary (size prefixed in varint)")
+	return cmd
+}
 
-	rootCmd.Flags().StringVarP(&protoSrcPath, "source-path", "s", "", "source path of proto files")
-	rootCmd.Flags().StringVarP(&protoDstPath, "dest-path", "d", "", "destination path of generated proto files")
-	rootCmd.Flags().StringVarP(&cfgFile, "config", "c", "", "tool config file")
-	rootCmd.Execute()
+func parseArgs() {
+	var baseline string
+	var allowBreaking bool
+	var rootCmd = &cobra.Command{
+		Use:     "proto-parse-tcaplus",
+		Short:   "Parse business proto files and write to new proto files for TcaplusDB",
+		Long:    "Parse business proto files and write to new proto files for TcaplusDB ",
+		Example: `  ./proto-parse-tcaplus convert -s "./testdata/test" -d "./out/test" -c "./config/proto_parse.cfg"`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			//flags of root command are kept for compatibility, same as convert command
+			if protoSrcPath == "" || protoDstPath == "" {
+				cmd.Help()
+				os.Exit(exitOK)
+			}
+			runConvert(baseline, allowBreaking, false)
+		},
+	}
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "tool config file")
+	rootCmd.PersistentFlags().StringArrayVar(&configSets, "set", nil, "override config item of business or tcaplusdb section, such as business.base_tables=BaseRoles,BaseGUID, can be repeated")
+	rootCmd.AddCommand(newConvertCmd(), newValidateCmd(), newInspectCmd(), newInitCmd(), newConfigCmd(), newDiffCmd(), newPlanCmd(), newMigrateCmd())
 
+	addPathFlags(rootCmd, true)
+	rootCmd.Flags().StringVar(&baseline, "baseline", "", "directory of baseline proto files, exit non-zero on breaking changes against it")
+	rootCmd.Flags().BoolVar(&allowBreaking, "allow-breaking", false, "allow breaking changes against baseline")
+	for _, flag := range []string{"source-path", "dest-path", "baseline", "allow-breaking"} {
+		rootCmd.Flags().MarkDeprecated(flag, "use convert command instead")
+	}
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(exitUsage)
+	}
 }
 func main() {
 	parseArgs()
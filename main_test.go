@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//load demo config and convert source path to destination path like convert command
+func convertForTest(t *testing.T, srcPath string, dstPath string) error {
+	return convertWithConfig(t, "config/proto_parse.cfg", srcPath, dstPath)
+}
+
+//load config file and convert source path to destination path like convert command
+func convertWithConfig(t *testing.T, config string, srcPath string, dstPath string) error {
+	resetParseState()
+	cfgFile = config
+	if !assert.NoError(t, loadConfig()) {
+		t.FailNow()
+	}
+	return ProtoParseAndWrite(srcPath, dstPath, comm.IgnoreProtoFiles)
+}
+
+//copy proto files of testdata into a temporary directory, so that they can be edited by test
+func copyTestdata(t *testing.T) string {
+	dir := t.TempDir()
+	files, err := ioutil.ReadDir("testdata/test")
+	assert.NoError(t, err)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/test", f.Name()))
+		assert.NoError(t, err)
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, f.Name()), data, 0644))
+	}
+	return dir
+}
+
+//replace content of proto file
+func editFile(t *testing.T, file string, edit func(string) string) {
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(file, []byte(edit(string(data))), 0644))
+}
+
+//get field numbers of generated table, key: field name
+func fieldNumbers(t *testing.T, dstPath string, table string) map[string]int {
+	schema, err := loadSchema(dstPath)
+	assert.NoError(t, err)
+	numbers := map[string]int{}
+	for _, field := range schema[table].msg.Fields {
+		numbers[field.Name] = field.ID
+	}
+	return numbers
+}
+
+func TestCheckMode(t *testing.T) {
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	split := filepath.Join(dst, "table_split_message.proto")
+	committed, err := ioutil.ReadFile(split)
+	assert.NoError(t, err)
+	cfgFile, protoSrcPath, protoDstPath, checkOutputs = "config/proto_parse.cfg", src, dst, true
+	defer func() { protoSrcPath, protoDstPath, checkOutputs = "", "", false }()
+	check := func() (int, string) {
+		var code int
+		out := captureOutput(t, func() {
+			var err error
+			code, err = convertOnce("", false)
+			assert.NoError(t, err)
+		})
+		return code, out
+	}
+
+	code, out := check()
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "generated files are up to date\n")
+
+	//changed source makes the committed file stale, which is not written
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		return regexp.MustCompile(`uint32 exp = 5;`).ReplaceAllString(s, "uint64 exp = 5;")
+	})
+	code, out = check()
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, out, "[CHANGED] "+split+"\n")
+	assert.Contains(t, out, "1 generated files are out of date, run convert to update them\n")
+	data, err := ioutil.ReadFile(split)
+	assert.NoError(t, err)
+	assert.Equal(t, string(committed), string(data))
+
+	//missing file is stale, extra file is listed but does not fail the check
+	checkOutputs = false
+	assert.NoError(t, convertForTest(t, src, dst))
+	checkOutputs = true
+	assert.NoError(t, os.Remove(filepath.Join(dst, "base.proto")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dst, "notes.txt"), nil, 0644))
+	code, out = check()
+	assert.Equal(t, exitFailed, code)
+	assert.Contains(t, out, "[MISSING] "+filepath.Join(dst, "base.proto")+"\n")
+	assert.Contains(t, out, "[EXTRA] "+filepath.Join(dst, "notes.txt")+"\n")
+	assert.NotContains(t, out, "[CHANGED]")
+	_, err = os.Stat(filepath.Join(dst, "base.proto"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJSONReport(t *testing.T) {
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, os.Remove(filepath.Join(src, "social.proto")))
+	reportFile = filepath.Join(t.TempDir(), "report.json")
+	cfgFile, protoSrcPath, protoDstPath, reportFormat = "config/proto_parse.cfg", src, dst, reportJSON
+	defer func() { protoSrcPath, protoDstPath, reportFormat, reportFile = "", "", reportText, "" }()
+	readReport := func() parseReport {
+		var r parseReport
+		data, err := ioutil.ReadFile(reportFile)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, &r))
+		return r
+	}
+
+	//blob category without messages fails its own file
+	code, err := convertOnce("", false)
+	assert.NoError(t, err)
+	assert.Equal(t, exitValidation, code)
+	r := readReport()
+	assert.False(t, r.Success)
+	files := map[string]reportOutputFile{}
+	for _, f := range r.Files {
+		files[f.File] = f
+	}
+	assert.Equal(t, reportOutputFile{File: "blob_user_data_social.proto", Status: "FAIL", Tables: []reportTable{},
+		Errors: []reportError{{Kind: errorNoBlobMessages, Detail: "no SOCIAL blob messages"}}}, files["blob_user_data_social.proto"])
+	assert.Equal(t, []reportTable{{Name: "BlobUserDataOut", Category: "BLOB", PrimaryKey: "UID", Sources: []string{"OUT_ChaosBattle"}, Fields: 3}},
+		files["blob_user_data_out.proto"].Tables)
+	assert.Equal(t, "SUCCESS", files["table_pub_message.proto"].Status)
+	messages := map[string]reportMessage{}
+	for _, m := range r.Messages {
+		messages[m.Name] = m
+	}
+	assert.Equal(t, reportMessage{Name: "Guild", File: "guild.proto", Kind: "PUB", Rule: "(tcaplus.table) annotation",
+		Table: "Guild", OutputFile: "table_pub_message.proto"}, messages["Guild"])
+	assert.Equal(t, reportMessage{Name: "BattlePassTaskList", File: "battlePass.proto", Kind: "COMM", Rule: "default rule"}, messages["BattlePassTaskList"])
+
+	//violations are reported with table and field, though nothing is written
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	cfgFile = filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(cfgFile, regexp.MustCompile(`max_fields = \d+`).ReplaceAll(data, []byte("max_fields = 3")), 0644))
+	code, err = convertOnce("", false)
+	assert.Error(t, err)
+	assert.Equal(t, exitValidation, code)
+	r = readReport()
+	assert.False(t, r.Success)
+	assert.Equal(t, "base.proto", r.Files[0].File)
+	assert.Equal(t, "FAIL", r.Files[0].Status)
+	assert.Contains(t, r.Files[0].Errors, reportError{Kind: errorViolation, Table: "BaseAccounts", Source: "BaseAccounts", Detail: "5 fields exceed the limit 3"})
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+//formats of dumped records
+const (
+	//one record per line in protobuf json
+	recordJSON string = "json"
+	//records in protobuf binary, each record is prefixed with its size in varint
+	recordBinary string = "binary"
+)
+
+//record formats supported by migrate
+var recordFormats = []string{recordJSON, recordBinary}
+
+//protobuf field types of generated table fields
+var fieldTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+//build protobuf file descriptor with tables of schema, field of message type refers to another table of the schema
+func schemaDescriptor(schema map[string]schemaTable, file string) (protoreflect.FileDescriptor, error) {
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String(file),
+		Package: proto.String(comm.TcaplusPackageName),
+		Syntax:  proto.String("proto3"),
+	}
+	var names []string
+	for name := range schema {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		mdp := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		for _, field := range schema[name].msg.Fields {
+			fp := &descriptorpb.FieldDescriptorProto{
+				Name:   proto.String(field.Name),
+				Number: proto.Int32(int32(field.ID)),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if field.IsRepeated {
+				fp.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			if ftype, ok := fieldTypes[field.Type]; ok {
+				fp.Type = ftype.Enum()
+			} else if _, ok := schema[field.Type]; ok {
+				fp.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				fp.TypeName = proto.String(fmt.Sprintf(".%s.%s", comm.TcaplusPackageName, field.Type))
+			} else {
+				return nil, fmt.Errorf("unknown type %s of %s.%s", field.Type, name, field.Name)
+			}
+			mdp.Field = append(mdp.Field, fp)
+		}
+		fdp.MessageType = append(fdp.MessageType, mdp)
+	}
+	return protodesc.NewFile(fdp, new(protoregistry.Files))
+}
+
+//get table message descriptor from generated proto files of directory
+func tableDescriptor(dir string, table string) (protoreflect.MessageDescriptor, error) {
+	schema, err := loadSchema(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load %s error: %v", dir, err)
+	}
+	if _, ok := schema[table]; !ok {
+		return nil, fmt.Errorf("table %s not exist in %s", table, dir)
+	}
+	fd, err := schemaDescriptor(schema, dir)
+	if err != nil {
+		return nil, fmt.Errorf("build descriptor of %s error: %v", dir, err)
+	}
+	return fd.Messages().ByName(protoreflect.Name(table)), nil
+}
+
+//get columns renamed between old and new table by lock files, columns of the same source are renamed
+//key: old column name, value: new column name, nothing renamed if no lock file or no sources in lock file
+func renamedColumns(oldDir string, newDir string, oldTable string, newTable string) (map[string]string, error) {
+	oldLock, err := loadLock(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newLock, err := loadLock(newDir)
+	if err != nil {
+		return nil, err
+	}
+	renames := map[string]string{}
+	for oldName, oldSource := range oldLock.Tables[oldTable].Sources {
+		for newName, newSource := range newLock.Tables[newTable].Sources {
+			if newSource == oldSource && newName != oldName {
+				renames[oldName] = newName
+			}
+		}
+	}
+	return renames, nil
+}
+
+//get field of new message mapped from field of old message
+//fields are the same if both name and number match, or the field is renamed by lock files, nil returned if field is dropped
+//a number reused by another field is not mapped, data of removed field is dropped
+func mappedField(from protoreflect.FieldDescriptor, to protoreflect.MessageDescriptor, renames map[string]string) protoreflect.FieldDescriptor {
+	if name, ok := renames[string(from.Name())]; ok {
+		return to.Fields().ByName(protoreflect.Name(name))
+	}
+	if fd := to.Fields().ByName(from.Name()); fd != nil && fd.Number() == from.Number() {
+		return fd
+	}
+	return nil
+}
+
+//copy fields of old record into new record, values are converted to types of new fields
+//renames are the renamed columns of table, fields of nested messages are mapped by name and number
+func migrateMessage(src protoreflect.Message, dst protoreflect.Message, renames map[string]string) error {
+	var err error
+	src.Range(func(from protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		to := mappedField(from, dst.Descriptor(), renames)
+		if to == nil {
+			return true
+		}
+		if err = migrateField(v, from, dst, to); err != nil {
+			err = fmt.Errorf("%s: %v", from.Name(), err)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+//set value of old field into new field, singular and repeated values are converted to each other
+func migrateField(v protoreflect.Value, from protoreflect.FieldDescriptor, dst protoreflect.Message, to protoreflect.FieldDescriptor) error {
+	var values []protoreflect.Value
+	if from.IsList() {
+		for i := 0; i < v.List().Len(); i++ {
+			values = append(values, v.List().Get(i))
+		}
+	} else {
+		values = append(values, v)
+	}
+	if !to.IsList() && len(values) > 1 {
+		return fmt.Errorf("%d values can not be put into singular field %s", len(values), to.Name())
+	}
+	for _, value := range values {
+		var cv protoreflect.Value
+		if to.Kind() == protoreflect.MessageKind {
+			if from.Kind() != protoreflect.MessageKind {
+				return fmt.Errorf("%s can not be converted to message %s", from.Kind(), to.Message().Name())
+			}
+			m := dst.NewField(to)
+			if to.IsList() {
+				m = dst.Mutable(to).List().NewElement()
+			}
+			if err := migrateMessage(value.Message(), m.Message(), nil); err != nil {
+				return err
+			}
+			cv = m
+		} else {
+			var err error
+			if cv, err = convertScalar(value, from.Kind(), to.Kind()); err != nil {
+				return err
+			}
+		}
+		if to.IsList() {
+			dst.Mutable(to).List().Append(cv)
+		} else {
+			dst.Set(to, cv)
+		}
+	}
+	return nil
+}
+
+//bit size of integer kinds, 0 for other kinds
+func intBits(k protoreflect.Kind) int {
+	switch k {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind, protoreflect.EnumKind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return 32
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return 64
+	}
+	return 0
+}
+
+func isUnsignedKind(k protoreflect.Kind) bool {
+	switch k {
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
+
+func isFloatKind(k protoreflect.Kind) bool {
+	return k == protoreflect.FloatKind || k == protoreflect.DoubleKind
+}
+
+//convert scalar value between kinds, integers out of range of new kind and lossy conversions are errors
+func convertScalar(v protoreflect.Value, from protoreflect.Kind, to protoreflect.Kind) (protoreflect.Value, error) {
+	if from == to {
+		return v, nil
+	}
+	fail := func() (protoreflect.Value, error) {
+		return protoreflect.Value{}, fmt.Errorf("value %v of %s can not be converted to %s", v.Interface(), from, to)
+	}
+	switch {
+	case intBits(from) > 0 && intBits(to) > 0:
+		var i int64
+		var u uint64
+		negative := false
+		if isUnsignedKind(from) {
+			u = v.Uint()
+		} else {
+			if from == protoreflect.EnumKind {
+				i = int64(v.Enum())
+			} else {
+				i = v.Int()
+			}
+			negative = i < 0
+			u = uint64(i)
+		}
+		if isUnsignedKind(to) {
+			if negative || (intBits(to) == 32 && u > math.MaxUint32) {
+				return fail()
+			}
+			if intBits(to) == 32 {
+				return protoreflect.ValueOfUint32(uint32(u)), nil
+			}
+			return protoreflect.ValueOfUint64(u), nil
+		}
+		if !negative {
+			if (intBits(to) == 32 && u > math.MaxInt32) || u > math.MaxInt64 {
+				return fail()
+			}
+			i = int64(u)
+		} else if intBits(to) == 32 && i < math.MinInt32 {
+			return fail()
+		}
+		switch {
+		case to == protoreflect.EnumKind:
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+		case intBits(to) == 32:
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+		return protoreflect.ValueOfInt64(i), nil
+	case intBits(from) > 0 && isFloatKind(to):
+		var f float64
+		if isUnsignedKind(from) {
+			f = float64(v.Uint())
+		} else if from == protoreflect.EnumKind {
+			f = float64(v.Enum())
+		} else {
+			f = float64(v.Int())
+		}
+		if to == protoreflect.FloatKind {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+		return protoreflect.ValueOfFloat64(f), nil
+	case isFloatKind(from) && isFloatKind(to):
+		if to == protoreflect.FloatKind {
+			if math.Abs(v.Float()) > math.MaxFloat32 {
+				return fail()
+			}
+			return protoreflect.ValueOfFloat32(float32(v.Float())), nil
+		}
+		return protoreflect.ValueOfFloat64(v.Float()), nil
+	case from == protoreflect.StringKind && to == protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(v.String())), nil
+	case from == protoreflect.BytesKind && to == protoreflect.StringKind:
+		if !utf8.Valid(v.Bytes()) {
+			return fail()
+		}
+		return protoreflect.ValueOfString(string(v.Bytes())), nil
+	}
+	return fail()
+}
+
+//read dumped records one by one, handle is called with data of each record
+func readRecords(r *bufio.Reader, format string, handle func(data []byte)) error {
+	for {
+		if format == recordBinary {
+			size, err := binary.ReadUvarint(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read record size error: %v", err)
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return fmt.Errorf("read record error: %v", err)
+			}
+			handle(data)
+			continue
+		}
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			handle(line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read record error: %v", err)
+		}
+	}
+}
+
+func unmarshalRecord(data []byte, format string, m protoreflect.Message) error {
+	if format == recordBinary {
+		return proto.Unmarshal(data, m.Interface())
+	}
+	return protojson.Unmarshal(data, m.Interface())
+}
+
+func marshalRecord(m protoreflect.Message, format string) ([]byte, error) {
+	if format == recordBinary {
+		data, err := proto.Marshal(m.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return append(protowire.AppendVarint(nil, uint64(len(data))), data...), nil
+	}
+	data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+//migrate records dumped from table of old generated proto files into records of table of new generated proto files
+//records failed to migrate are reported and skipped, the number of failed records is returned
+func MigrateRecords(oldDir string, newDir string, oldTable string, newTable string, input string, output string, format string) (int, error) {
+	if !containsString(recordFormats, format) {
+		return 0, fmt.Errorf("unknown record format %s, should be one of %v", format, recordFormats)
+	}
+	if newTable == "" {
+		newTable = oldTable
+	}
+	oldDesc, err := tableDescriptor(oldDir, oldTable)
+	if err != nil {
+		return 0, err
+	}
+	newDesc, err := tableDescriptor(newDir, newTable)
+	if err != nil {
+		return 0, err
+	}
+	renames, err := renamedColumns(oldDir, newDir, oldTable, newTable)
+	if err != nil {
+		return 0, err
+	}
+	//field mapping of table
+	fmt.Printf("Migrate %s of %s to %s of %s\n", oldTable, oldDir, newTable, newDir)
+	for i := 0; i < oldDesc.Fields().Len(); i++ {
+		from := oldDesc.Fields().Get(i)
+		if to := mappedField(from, newDesc, renames); to == nil {
+			if fd := newDesc.Fields().ByName(from.Name()); fd != nil {
+				fmt.Printf("field %s is dropped, number changed from %d to %d\n", from.Name(), from.Number(), fd.Number())
+			} else {
+				fmt.Printf("field %s is dropped\n", from.Name())
+			}
+		} else if to.Name() != from.Name() {
+			fmt.Printf("field %s is mapped to %s, renamed by lock file\n", from.Name(), to.Name())
+		}
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return 0, fmt.Errorf("open records error: %v", err)
+	}
+	defer in.Close()
+	out, err := os.Create(output)
+	if err != nil {
+		return 0, fmt.Errorf("create records error: %v", err)
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	total, failed := 0, 0
+	var writeErr error
+	err = readRecords(bufio.NewReader(in), format, func(data []byte) {
+		if writeErr != nil {
+			return
+		}
+		total = total + 1
+		src := dynamicpb.NewMessage(oldDesc)
+		dst := dynamicpb.NewMessage(newDesc)
+		err := unmarshalRecord(data, format, src)
+		if err == nil {
+			err = migrateMessage(src, dst, renames)
+		}
+		var record []byte
+		if err == nil {
+			record, err = marshalRecord(dst, format)
+		}
+		if err != nil {
+			failed = failed + 1
+			fmt.Printf("[record %d] migrate error: %v\n", total, err)
+			return
+		}
+		if _, err := w.Write(record); err != nil {
+			writeErr = fmt.Errorf("write records error: %v", err)
+		}
+	})
+	if err != nil {
+		return failed, err
+	}
+	if writeErr != nil {
+		return failed, writeErr
+	}
+	if err := w.Flush(); err != nil {
+		return failed, fmt.Errorf("write records error: %v", err)
+	}
+	fmt.Printf("%d records migrated, %d failed, written to %s\n", total-failed, failed, output)
+	return failed, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestConvertScalar(t *testing.T) {
+	cases := []struct {
+		name string
+		v    protoreflect.Value
+		from protoreflect.Kind
+		to   protoreflect.Kind
+		want protoreflect.Value
+		ok   bool
+	}{
+		{"same kind", protoreflect.ValueOfUint32(7), protoreflect.Uint32Kind, protoreflect.Uint32Kind, protoreflect.ValueOfUint32(7), true},
+		{"uint32 to uint64", protoreflect.ValueOfUint32(7), protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.ValueOfUint64(7), true},
+		{"uint64 to uint32", protoreflect.ValueOfUint64(7), protoreflect.Uint64Kind, protoreflect.Uint32Kind, protoreflect.ValueOfUint32(7), true},
+		{"uint64 out of uint32", protoreflect.ValueOfUint64(math.MaxUint32 + 1), protoreflect.Uint64Kind, protoreflect.Uint32Kind, protoreflect.Value{}, false},
+		{"uint64 out of int32", protoreflect.ValueOfUint64(math.MaxInt32 + 1), protoreflect.Uint64Kind, protoreflect.Int32Kind, protoreflect.Value{}, false},
+		{"uint64 out of int64", protoreflect.ValueOfUint64(math.MaxInt64 + 1), protoreflect.Uint64Kind, protoreflect.Int64Kind, protoreflect.Value{}, false},
+		{"int32 to int64", protoreflect.ValueOfInt32(-7), protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.ValueOfInt64(-7), true},
+		{"int64 to sint32", protoreflect.ValueOfInt64(-7), protoreflect.Int64Kind, protoreflect.Sint32Kind, protoreflect.ValueOfInt32(-7), true},
+		{"int64 out of int32", protoreflect.ValueOfInt64(math.MinInt32 - 1), protoreflect.Int64Kind, protoreflect.Int32Kind, protoreflect.Value{}, false},
+		{"negative int64 to uint32", protoreflect.ValueOfInt64(-1), protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Value{}, false},
+		{"enum to int32", protoreflect.ValueOfEnum(3), protoreflect.EnumKind, protoreflect.Int32Kind, protoreflect.ValueOfInt32(3), true},
+		{"int32 to enum", protoreflect.ValueOfInt32(3), protoreflect.Int32Kind, protoreflect.EnumKind, protoreflect.ValueOfEnum(3), true},
+		{"uint32 to double", protoreflect.ValueOfUint32(7), protoreflect.Uint32Kind, protoreflect.DoubleKind, protoreflect.ValueOfFloat64(7), true},
+		{"int64 to float", protoreflect.ValueOfInt64(-7), protoreflect.Int64Kind, protoreflect.FloatKind, protoreflect.ValueOfFloat32(-7), true},
+		{"float to double", protoreflect.ValueOfFloat32(1.5), protoreflect.FloatKind, protoreflect.DoubleKind, protoreflect.ValueOfFloat64(1.5), true},
+		{"double to float", protoreflect.ValueOfFloat64(1.5), protoreflect.DoubleKind, protoreflect.FloatKind, protoreflect.ValueOfFloat32(1.5), true},
+		{"double out of float", protoreflect.ValueOfFloat64(math.MaxFloat64), protoreflect.DoubleKind, protoreflect.FloatKind, protoreflect.Value{}, false},
+		{"double to int64", protoreflect.ValueOfFloat64(1), protoreflect.DoubleKind, protoreflect.Int64Kind, protoreflect.Value{}, false},
+		{"string to bytes", protoreflect.ValueOfString("abc"), protoreflect.StringKind, protoreflect.BytesKind, protoreflect.ValueOfBytes([]byte("abc")), true},
+		{"bytes to string", protoreflect.ValueOfBytes([]byte("abc")), protoreflect.BytesKind, protoreflect.StringKind, protoreflect.ValueOfString("abc"), true},
+		{"invalid utf8 bytes to string", protoreflect.ValueOfBytes([]byte{0xff}), protoreflect.BytesKind, protoreflect.StringKind, protoreflect.Value{}, false},
+		{"bool to uint32", protoreflect.ValueOfBool(true), protoreflect.BoolKind, protoreflect.Uint32Kind, protoreflect.Value{}, false},
+		{"string to int64", protoreflect.ValueOfString("1"), protoreflect.StringKind, protoreflect.Int64Kind, protoreflect.Value{}, false},
+	}
+	for _, c := range cases {
+		got, err := convertScalar(c.v, c.from, c.to)
+		if !c.ok {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		if assert.NoError(t, err, c.name) {
+			assert.Equal(t, c.want.Interface(), got.Interface(), c.name)
+		}
+	}
+}
+
+func TestMigrateRecords(t *testing.T) {
+	src, oldDir, newDir := copyTestdata(t), t.TempDir(), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, oldDir))
+	//exp is narrowed to int32, mailLevel is dropped
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		s = regexp.MustCompile(`uint32 exp = 5;`).ReplaceAllString(s, "int32 exp = 5;")
+		return regexp.MustCompile(`(?m)^.*mailLevel.*\n`).ReplaceAllString(s, "")
+	})
+	assert.NoError(t, convertForTest(t, src, newDir))
+	oldDesc, err := tableDescriptor(oldDir, "OUT_BattlePass")
+	assert.NoError(t, err)
+	newDesc, err := tableDescriptor(newDir, "OUT_BattlePass")
+	assert.NoError(t, err)
+
+	for _, format := range recordFormats {
+		dir := t.TempDir()
+		input, output := filepath.Join(dir, "old."+format), filepath.Join(dir, "new."+format)
+		in, err := os.Create(input)
+		assert.NoError(t, err)
+		//the second record fails, as exp is out of range of int32
+		for i, exp := range []uint32{10, math.MaxInt32 + 1, 20} {
+			m := dynamicpb.NewMessage(oldDesc)
+			m.Set(oldDesc.Fields().ByName("UUID"), protoreflect.ValueOfUint64(uint64(i+1)))
+			m.Set(oldDesc.Fields().ByName("Exp"), protoreflect.ValueOfUint32(exp))
+			m.Set(oldDesc.Fields().ByName("MailLevel"), protoreflect.ValueOfUint32(3))
+			data, err := marshalRecord(m, format)
+			assert.NoError(t, err)
+			_, err = in.Write(data)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, in.Close())
+
+		failed, err := MigrateRecords(oldDir, newDir, "OUT_BattlePass", "", input, output, format)
+		assert.NoError(t, err, format)
+		assert.Equal(t, 1, failed, format)
+
+		out, err := os.Open(output)
+		assert.NoError(t, err)
+		var records [][2]interface{}
+		assert.NoError(t, readRecords(bufio.NewReader(out), format, func(data []byte) {
+			m := dynamicpb.NewMessage(newDesc)
+			assert.NoError(t, unmarshalRecord(data, format, m))
+			records = append(records, [2]interface{}{m.Get(newDesc.Fields().ByName("UUID")).Uint(), m.Get(newDesc.Fields().ByName("Exp")).Int()})
+		}))
+		out.Close()
+		assert.Equal(t, [][2]interface{}{{uint64(1), int64(10)}, {uint64(3), int64(20)}}, records, format)
+	}
+
+	_, err = MigrateRecords(oldDir, newDir, "OUT_BattlePass", "", "", "", "xml")
+	assert.Error(t, err)
+}
+
+func TestMigrateRenamedAndReusedFields(t *testing.T) {
+	src, oldDir, newDir := copyTestdata(t), t.TempDir(), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, oldDir))
+	//mailLevel is removed, its number is reused by mailCount, as new proto files are generated without lock file
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		return regexp.MustCompile(`mailLevel = 7;`).ReplaceAllString(s, "mailCount = 7;")
+	})
+	//columns are renamed by naming policy, they have the same sources in lock files
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(config, regexp.MustCompile(`naming_policy = "title"`).ReplaceAll(data, []byte(`naming_policy = "lowerCamel"`)), 0644))
+	assert.NoError(t, convertWithConfig(t, config, src, newDir))
+	oldDesc, err := tableDescriptor(oldDir, "OUT_BattlePass")
+	assert.NoError(t, err)
+	newDesc, err := tableDescriptor(newDir, "outBattlePass")
+	assert.NoError(t, err)
+	assert.Equal(t, oldDesc.Fields().ByName("MailLevel").Number(), newDesc.Fields().ByName("mailCount").Number())
+
+	dir := t.TempDir()
+	input, output := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+	m := dynamicpb.NewMessage(oldDesc)
+	m.Set(oldDesc.Fields().ByName("UUID"), protoreflect.ValueOfUint64(1))
+	m.Set(oldDesc.Fields().ByName("Exp"), protoreflect.ValueOfUint32(10))
+	m.Set(oldDesc.Fields().ByName("MailLevel"), protoreflect.ValueOfUint32(3))
+	record, err := marshalRecord(m, "json")
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(input, record, 0644))
+
+	out := captureOutput(t, func() {
+		failed, err := MigrateRecords(oldDir, newDir, "OUT_BattlePass", "outBattlePass", input, output, "json")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, failed)
+	})
+	assert.Contains(t, out, "field Exp is mapped to exp, renamed by lock file\n")
+	assert.Contains(t, out, "field MailLevel is dropped\n")
+
+	f, err := os.Open(output)
+	assert.NoError(t, err)
+	defer f.Close()
+	var records []map[string]uint64
+	assert.NoError(t, readRecords(bufio.NewReader(f), "json", func(data []byte) {
+		m := dynamicpb.NewMessage(newDesc)
+		assert.NoError(t, unmarshalRecord(data, "json", m))
+		records = append(records, map[string]uint64{"uuid": m.Get(newDesc.Fields().ByName("uuid")).Uint(),
+			"exp": m.Get(newDesc.Fields().ByName("exp")).Uint(), "mailCount": m.Get(newDesc.Fields().ByName("mailCount")).Uint()})
+	}))
+	assert.Equal(t, []map[string]uint64{{"uuid": 1, "exp": 10, "mailCount": 0}}, records)
+}
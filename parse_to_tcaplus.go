@@ -6,6 +6,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/emicklei/proto"
@@ -32,15 +33,37 @@ var (
 
 	//save errors for each proto file
 	errorInfos = map[string]string{}
+	//typed errors of each proto file for report, violations are not included, key: proto file name
+	fileErrors = map[string][]reportError{}
+	//save warnings, such as conflict between table annotation and naming rules
+	warnInfos []string
+
+	//classification results of messages, key: message name
+	msgClasses = map[string]msgClass{}
+	//generated tables, key: proto file name
+	tables = map[string][]table{}
+	//violations of tcaplusdb engine limits
+	violations []violation
+
+	//dry run writes nothing, generated files are saved in generatedFiles instead
+	dryRun bool
+	//check mode writes nothing like dry run, generated files are compared with files in destination path
+	checkOutputs bool
+	//strict mode takes warnings as failures, such as dropped options and unresolved types
+	strictMode bool
+	//contents of generated files in dry run, key: file path
+	generatedFiles = map[string][]byte{}
 
 	//save base messages
 	baseMessages []comm.Message
-	//save blob IN and OUT messages
+	//save blob messages, key: blob category name, such as IN, OUT
 	blobMessages = map[string][]string{}
 	//split messages, message with IN or OUT prefix, UUID:primary key, UID: index
 	splitMessages []comm.Message
 	//pub messages, message with PUB prefix, UUID: primary key
 	pubMessages []comm.Message
+	//list messages, message with LIST prefix or list annotation, UID: primary key
+	listMessages []comm.Message
 
 	//save other messages (not  base, blob, split, and pub)
 	commMessages []comm.Message
@@ -54,30 +77,107 @@ var (
 	GeneralPackageName string = "entity"
 )
 
-//parse proto file and generate new proto file
-func ProtoParseAndWrite(srcPath string, dstPath string, ignores string) {
+//reset parse results of previous run, so that proto files can be parsed again
+func resetParseState() {
+	buf.Reset()
+	protoInfo = ProtoInfo{}
+	protoInfos = map[string]ProtoInfo{}
+	errorInfos = map[string]string{}
+	fileErrors = map[string][]reportError{}
+	warnInfos = nil
+	msgClasses = map[string]msgClass{}
+	tables = map[string][]table{}
+	violations = nil
+	generatedFiles = map[string][]byte{}
+	baseMessages = nil
+	blobMessages = map[string][]string{}
+	splitMessages = nil
+	pubMessages = nil
+	listMessages = nil
+	commMessages = nil
+	commEnums = nil
+	tempEnums = map[string][]comm.Enum{}
+}
+
+//error of generated tables violating tcaplusdb limits, generated files and lock file are not written
+var errInvalidTables = fmt.Errorf("generated tables are invalid, no file is written")
+
+//parse proto files and build tables, the tables are validated but not written
+//error with exitValidation is returned if any generated table is invalid, the results are kept for output
+func ProtoParseAndBuild(srcPath string, dstPath string, ignores string) error {
 	//traverse all proto files and parse them
 	err := traverseProtoFiles(srcPath, ignores)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return withCode(exitParse, err)
 	}
 	//classify message type
 	err = classifyProtoFiles(srcPath, ignores, dstPath)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return withCode(exitParse, err)
 	}
-	//generate proto files with parsed results
-	writeProtoFiles(dstPath)
+	//read stable states of previous run
+	err = readLockFile(dstPath)
+	if err != nil {
+		return withCode(exitParse, err)
+	}
+	//build tcaplusdb tables with classified messages
+	buildTables()
+	//reserve columns removed since previous run
+	err = reserveRemovedFields(dstPath)
+	if err != nil {
+		return withCode(exitParse, err)
+	}
+	//validate tables against tcaplusdb engine limits
+	validateTables()
+	if len(violations) > 0 {
+		return withCode(exitValidation, errInvalidTables)
+	}
+	return nil
+}
 
-	//output parse results for each proto file, SUCCESS or FAIL
-	err = outputParseResults(srcPath, ignores)
+//parse proto file and generate new proto file
+func ProtoParseAndWrite(srcPath string, dstPath string, ignores string) error {
+	err := ProtoParseAndBuild(srcPath, dstPath, ignores)
 	if err != nil {
-		fmt.Println(err)
-		return
+		if errorCode(err) == exitValidation {
+			//invalid tables and lock are not written, output why proto files failed
+			if err := outputParseResults(srcPath, ignores); err != nil {
+				return withCode(exitError, err)
+			}
+		}
+		return err
+	}
+	//generate proto files with built tables
+	writeProtoFiles(dstPath)
+	//save stable states for next run
+	err = writeLockFile(dstPath)
+	if err != nil {
+		return withCode(exitWrite, err)
+	}
+	//show what would change in dry run
+	if dryRun {
+		if _, err := outputDryRunDiff(dstPath); err != nil {
+			return withCode(exitError, err)
+		}
 	}
 
+	//output parse results for each proto file, SUCCESS or FAIL
+	return outputParseResults(srcPath, ignores)
+}
+
+//check whether any proto file failed to convert, warnings are failures in strict mode
+func convertFailed() bool {
+	return len(errorInfos) > 0 || (strictMode && len(warnInfos) > 0)
+}
+
+//add warning, the same warning is added once
+func addWarning(warn string) {
+	for _, w := range warnInfos {
+		if w == warn {
+			return
+		}
+	}
+	warnInfos = append(warnInfos, warn)
 }
 
 /*
@@ -96,7 +196,9 @@ func traverseProtoFiles(srcPath string, ignores string) error {
 	for _, file := range protoFiles {
 		filename := path.Base(file)
 		//parse proto file and save results into protoInfo (global variable)
-		parse(file)
+		if err := parse(file); err != nil {
+			return err
+		}
 		//add additional contents to protoInfo
 		protoInfo.imps = append(protoInfo.imps, comm.Import{Path: comm.TcaplusImportName})
 		//map the protoInfo to relative proto file , and save  into protoInfos
@@ -124,15 +226,20 @@ func classifyProtoFiles(srcPath string, ignores string, dstPath string) error {
 		}
 		for _, msg := range info.msgs {
 			//newName := tools.SnakeCase(msg.Name)
-			if blobType, ok := isBlobMessageType(msg); ok {
-				blobMessages[blobType] = append(blobMessages[blobType], msg.Name)
-			} else if _, ok := isInOrOutMessageType(msg); ok {
+			class := classifyMessage(msg)
+			msgClasses[msg.Name] = class
+			switch class.kind {
+			case "LIST":
+				listMessages = append(listMessages, msg)
+			case "BLOB":
+				blobMessages[class.blobType] = append(blobMessages[class.blobType], msg.Name)
+			case "SPLIT":
 				splitMessages = append(splitMessages, msg)
-			} else if _, ok := isPubMessageType(msg); ok {
+			case "PUB":
 				pubMessages = append(pubMessages, msg)
-			} else if ok := isBaseMessageType(msg); ok {
+			case "BASE":
 				baseMessages = append(baseMessages, msg)
-			} else {
+			default:
 				commMessages = append(commMessages, msg)
 			}
 
@@ -160,17 +267,33 @@ func checkAndAppendCommEnums(e comm.Enum) {
 
 //generate proto files, ignore generating common.proto and enumm_entity.proto
 func writeProtoFiles(dstPath string) {
-	writeBaseProtoFiles(dstPath)
+	writeTableProtoFile(dstPath, comm.TableFiles["BASE"])
 	writeBlobProtoFiles(dstPath)
-	writeSplitProtoFiles(dstPath)
-	writePubProtoFiles(dstPath)
+	writeTableProtoFile(dstPath, comm.TableFiles["SPLIT"])
+	writeTableProtoFile(dstPath, comm.TableFiles["PUB"])
+	if comm.TableFiles["LIST"] != "" {
+		writeTableProtoFile(dstPath, comm.TableFiles["LIST"])
+	}
+
+}
 
+//get generated proto files, table proto files and blob proto files, table category without proto file is skipped
+func outputProtoFiles() []string {
+	var protoFiles []string
+	for _, file := range []string{comm.TableFiles["BASE"], comm.TableFiles["PUB"], comm.TableFiles["SPLIT"], comm.TableFiles["LIST"]} {
+		if file != "" {
+			protoFiles = append(protoFiles, file)
+		}
+	}
+	for _, cat := range comm.BlobCategories {
+		protoFiles = append(protoFiles, cat.File)
+	}
+	return protoFiles
 }
 
 //output results for checking whether the parsing is ok or not
 func outputParseResults(srcPath string, ignores string) error {
-	protoFiles := []string{comm.TableFiles["BASE"], comm.TableFiles["PUB"], comm.TableFiles["SPLIT"], comm.BlobFiles["IN"], comm.BlobFiles["OUT"]}
-	for _, file := range protoFiles {
+	for _, file := range outputProtoFiles() {
 		filename := path.Base(file)
 		if err, ok := errorInfos[filename]; ok {
 			fmt.Println(fmt.Sprintf("[%v] convert [FAIL][%v]", filename, err))
@@ -178,17 +301,33 @@ func outputParseResults(srcPath string, ignores string) error {
 			fmt.Println(fmt.Sprintf("[%v] convert [SUCCESS]", filename))
 		}
 	}
+	for _, v := range violations {
+		fmt.Println(v.String())
+	}
+	for _, warn := range warnInfos {
+		fmt.Println(fmt.Sprintf("[WARNING] %v", warn))
+	}
+	if strictMode && len(warnInfos) > 0 {
+		fmt.Printf("%d warnings fail the conversion in strict mode\n", len(warnInfos))
+	}
 	return nil
 }
 
 //parse proto file
-func parse(protoSrcFile string) {
+func parse(protoSrcFile string) error {
 
-	reader, _ := os.Open(protoSrcFile)
+	reader, err := os.Open(protoSrcFile)
+	if err != nil {
+		return fmt.Errorf("open %s error: %v", protoSrcFile, err)
+	}
 	defer reader.Close()
 	//parse the proto syntax tree
 	parser := proto.NewParser(reader)
-	definition, _ := parser.Parse()
+	parser.Filename(protoSrcFile)
+	definition, err := parser.Parse()
+	if err != nil {
+		return fmt.Errorf("parse proto file error: %v", err)
+	}
 	//walk the proto file
 	proto.Walk(definition,
 		protoWithSyntax(handleSyntax),
@@ -198,7 +337,7 @@ func parse(protoSrcFile string) {
 		proto.WithEnum(handleEnum),
 		proto.WithMessage(handleMessage),
 	)
-
+	return nil
 }
 
 func protoWithSyntax(apply func(p *proto.Syntax)) proto.Handler {
@@ -293,16 +432,21 @@ func parseMessage(m *proto.Message) comm.Message {
 		Name: m.Name,
 	}
 	for _, v := range m.Elements {
-		if _, ok := v.(*proto.Option); ok {
-			//not parse, meaningless for tcaplusdb
+		if o, ok := v.(*proto.Option); ok {
+			//message option, such as list annotation
+			msg.Options = append(msg.Options, parseOption(o))
 		}
 		if f, ok := v.(*proto.NormalField); ok {
-			msg.Fields = append(msg.Fields, comm.Field{
+			field := comm.Field{
 				ID:         f.Sequence,
 				Name:       f.Name,
 				Type:       f.Type,
 				IsRepeated: f.Repeated,
-			})
+			}
+			for _, o := range f.Options {
+				field.Options = append(field.Options, parseOption(o))
+			}
+			msg.Fields = append(msg.Fields, field)
 		}
 		if mmp, ok := v.(*proto.MapField); ok {
 			f := mmp.Field
@@ -332,8 +476,17 @@ func parseMessage(m *proto.Message) comm.Message {
 			msg.Fields = append(msg.Fields, fields...)
 		}
 
-		if _, ok := v.(*proto.Reserved); ok {
-			//not parse
+		if r, ok := v.(*proto.Reserved); ok {
+			//reserved numbers and names, the range to max is not expanded
+			for _, rg := range r.Ranges {
+				if rg.Max {
+					continue
+				}
+				for id := rg.From; id <= rg.To; id++ {
+					msg.ReservedIDs = append(msg.ReservedIDs, id)
+				}
+			}
+			msg.ReservedNames = append(msg.ReservedNames, r.FieldNames...)
 		}
 
 		if m, ok := v.(*proto.Message); ok {
@@ -346,123 +499,114 @@ func parseMessage(m *proto.Message) comm.Message {
 	return msg
 }
 
-func writeBaseProtoFiles(dstPath string) {
-	errStr := ""
-	baseProtoFileName := comm.TableFiles["BASE"]
-	dstFile := filepath.Join(dstPath, baseProtoFileName)
-
-	//write syntax, package, import
-	writeProtoFileHead()
-	for _, msg := range baseMessages {
-		err := writeBaseMessage(msg)
-		if err != nil {
-			errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
-		}
-	}
-	/*
-		//write nested enums
-		if es, ok := tempEnums["BASE"]; ok {
-			for _, e := range es {
-				writeEnum(e)
-			}
-		}
-	*/
-	err := tools.WriteFile(dstFile, buf.Bytes())
-	if err != nil {
-		errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
+//parse option, aggregated option such as `{kind: SPLIT}` is saved into Aggregated
+func parseOption(o *proto.Option) comm.Option {
+	opt := comm.Option{
+		Name:  o.Name,
+		Value: o.Constant.Source,
 	}
-	buf.Reset()
-
-	if errStr != "" {
-		errorInfos[baseProtoFileName] = errStr
+	for _, l := range o.Constant.OrderedMap {
+		opt.Aggregated = append(opt.Aggregated, comm.Option{
+			Name:  l.Name,
+			Value: l.Literal.Source,
+		})
 	}
+	return opt
 }
 
-//put parse results into bytes.Buffer
-func writeSplitProtoFiles(dstPath string) {
-	errStr := ""
-	splitProtoFileName := comm.TableFiles["SPLIT"]
-	dstFile := filepath.Join(dstPath, splitProtoFileName)
-	//write syntax, package, import
-	writeProtoFileHead()
-
+//build tcaplusdb tables of base, split, pub, list and blob messages, and save into tables by proto file
+func buildTables() {
+	for _, msg := range baseMessages {
+		t, err := buildBaseTable(msg)
+		addTable(comm.TableFiles["BASE"], t, err)
+	}
 	for _, msg := range splitMessages {
-		err := writeSplitMessage(msg, "SPLIT")
-		if err != nil {
-			errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
+		t, err := buildSplitTable(msg, "SPLIT")
+		addTable(comm.TableFiles["SPLIT"], t, err)
+	}
+	for _, msg := range pubMessages {
+		t, err := buildPubTable(msg, "PUB")
+		addTable(comm.TableFiles["PUB"], t, err)
+	}
+	if comm.TableFiles["LIST"] != "" {
+		for _, msg := range listMessages {
+			t, err := buildListTable(msg, "LIST")
+			addTable(comm.TableFiles["LIST"], t, err)
+		}
+	} else if len(listMessages) > 0 {
+		//no list proto file specified, ignore list messages
+		var names []string
+		for _, msg := range listMessages {
+			names = append(names, msg.Name)
 		}
+		addWarning(fmt.Sprintf("list messages %s are ignored, no LIST proto file in table_proto_files", strings.Join(names, ",")))
 	}
-	/*
-		//write nested enums
-		if es, ok := tempEnums["SPLIT"]; ok {
-			for _, e := range es {
-				writeEnum(e)
-			}
+	//build BLOB messages to blob table of each blob category (blob_user_data_out, blob_user_data_in)
+	for _, cat := range comm.BlobCategories {
+		msgs, ok := blobMessages[cat.Name]
+		if !ok {
+			addFileError(cat.File, errorNoBlobMessages, fmt.Sprintf("no %v blob messages", cat.Name))
+			continue
+		}
+		if !isSplitBlobCategory(cat) {
+			t, err := buildBlobTable(cat, cat.Table, msgs)
+			addTable(cat.File, t, err)
+			continue
+		}
+		//split oversized blob table into several tables, such as BlobUserDataOut_1, BlobUserDataOut_2
+		for i, group := range assignBlobTables(cat, msgs) {
+			t, err := buildBlobTable(cat, splitBlobTableName(cat, i), group)
+			addTable(cat.File, t, err)
 		}
-	*/
-	err := tools.WriteFile(dstFile, buf.Bytes())
-	if err != nil {
-		errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
 	}
-	buf.Reset()
+}
 
-	if errStr != "" {
-		errorInfos[splitProtoFileName] = errStr
+func addTable(file string, t table, err error) {
+	if err != nil {
+		addFileError(file, errorBuild, err.Error())
+		return
 	}
+	tables[file] = append(tables[file], t)
+}
 
+//add typed error of proto file, the error is also added to errorInfos
+func addFileError(file string, kind string, errStr string) {
+	fileErrors[file] = append(fileErrors[file], reportError{Kind: kind, Detail: errStr})
+	addErrorInfo(file, errStr)
+}
+
+func addErrorInfo(file string, errStr string) {
+	if e, ok := errorInfos[file]; ok {
+		errorInfos[file] = fmt.Sprintf("%s;%s", e, errStr)
+	} else {
+		errorInfos[file] = errStr
+	}
 }
 
-func writePubProtoFiles(dstPath string) {
-	errStr := ""
-	pubProtoFileName := comm.TableFiles["PUB"]
-	dstFile := filepath.Join(dstPath, pubProtoFileName)
+//put tables of proto file into bytes.Buffer and write to destination path
+func writeTableProtoFile(dstPath string, file string) {
+	dstFile := filepath.Join(dstPath, file)
 	//write syntax, package, import
 	writeProtoFileHead()
-	for _, msg := range pubMessages {
-		err := writePubMessage(msg, "PUB")
-		if err != nil {
-			errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
-		}
+	for _, t := range tables[file] {
+		writeTable(t)
 	}
-	/*
-		//write nested enums
-		if es, ok := tempEnums["PUB"]; ok {
-			for _, e := range es {
-				writeEnum(e)
-			}
-		}
-	*/
-	err := tools.WriteFile(dstFile, buf.Bytes())
-	if err != nil {
-		errStr = fmt.Sprintf("%s;%s", errStr, err.Error())
+	if writeNothing() {
+		generatedFiles[dstFile] = append([]byte{}, buf.Bytes()...)
+	} else if err := tools.WriteFile(dstFile, buf.Bytes()); err != nil {
+		addFileError(file, errorWrite, err.Error())
 	}
+	//reset to empty for next proto file
 	buf.Reset()
-
-	if errStr != "" {
-		errorInfos[pubProtoFileName] = errStr
-	}
 }
 
 func writeBlobProtoFiles(dstPath string) {
-	//write BLOB messages to specified message (blob_user_data_out, blob_user_data_in)
-	for msgType, file := range comm.BlobFiles {
-		msgs, ok := blobMessages[msgType]
-		if !ok {
-			errorInfos[file] = fmt.Sprintf("no %v blob messages", msgType)
-		} else {
-			err := writeBlobMessages(msgType, msgs)
-			if err != nil {
-				errorInfos[file] = err.Error()
-			}
-			dstFile := filepath.Join(dstPath, file)
-			err = tools.WriteFile(dstFile, buf.Bytes())
-			if err != nil {
-				errorInfos[file] = err.Error()
-			}
+	for _, cat := range comm.BlobCategories {
+		if _, ok := blobMessages[cat.Name]; !ok {
+			//no blob messages, not generate
+			continue
 		}
-
-		//reset to empty for next proto file
-		buf.Reset()
+		writeTableProtoFile(dstPath, cat.File)
 	}
 }
 func writeProtoFileHead() {
@@ -501,156 +645,218 @@ func writeEnum(e comm.Enum) {
 	buf.WriteString("}\n")
 }
 
-func writeBaseMessage(msg comm.Message) error {
-	if pk, ok := comm.BaseTableMap[msg.Name]; ok {
-		//	newName := tools.SnakeCase(msg.Name)
-		buf.WriteString(fmt.Sprintf("message %s{\n", msg.Name))
-		optStr := fmt.Sprintf("\toption(tcaplusservice.tcaplus_primary_key) = \"%s\";\n", pk)
-		buf.WriteString(optStr)
-	} else {
-		return fmt.Errorf("write %s message option error, message name not in BaseTableMap", msg.Name)
+func buildBaseTable(msg comm.Message) (table, error) {
+	t := newTable(msg.Name, "BASE", msg.Name)
+	pk, ok := tablePrimaryKey(msg.Name, "BASE")
+	if !ok {
+		return t, fmt.Errorf("write %s message option error, message name not in BaseTableMap", msg.Name)
 	}
-	if err := writeMessageBody(msg, "BASE"); err != nil {
-		return err
+	//	newName := tools.SnakeCase(msg.Name)
+	if err := buildMessageBody(&t, msg, "BASE"); err != nil {
+		return t, err
 	}
-	buf.WriteString("}\n")
-	return nil
+	return t, addKeyOptions(&t, pk, "")
 }
-func writeSplitMessage(msg comm.Message, msgType string) error {
+func buildSplitTable(msg comm.Message, msgType string) (table, error) {
+	t := newTable(msg.Name, msgType, msg.Name)
+	pk, ok := tablePrimaryKey(msg.Name, msgType)
+	if !ok {
+		return t, fmt.Errorf("write %s message option error, no primary key", msg.Name)
+	}
 	// newName := tools.SnakeCase(msg.Name)
-	buf.WriteString(fmt.Sprintf("message %s{\n", msg.Name))
-	optStr := fmt.Sprintf("\toption(tcaplusservice.tcaplus_primary_key) = \"UUID,UID\";\n")
-	buf.WriteString(optStr)
-	optStr = fmt.Sprintf("\toption(tcaplusservice.tcaplus_index) = \"index_1(UID)\";\n")
-	buf.WriteString(optStr)
-	if err := writeMessageBody(msg, msgType); err != nil {
-		return err
+	if err := buildMessageBody(&t, msg, msgType); err != nil {
+		return t, err
 	}
-	buf.WriteString("}\n")
-	return nil
+	return t, addKeyOptions(&t, pk, "")
 }
-func writePubMessage(msg comm.Message, msgType string) error {
+func buildPubTable(msg comm.Message, msgType string) (table, error) {
+	t := newTable(msg.Name, msgType, msg.Name)
+	pk, ok := tablePrimaryKey(msg.Name, msgType)
+	if !ok {
+		return t, fmt.Errorf("write %s message option error, no primary key", msg.Name)
+	}
 	//newName := tools.SnakeCase(msg.Name)
-	buf.WriteString(fmt.Sprintf("message %s{\n", msg.Name))
-	optStr := fmt.Sprintf("\toption(tcaplusservice.tcaplus_primary_key) = \"UUID\";\n")
-	buf.WriteString(optStr)
-	if err := writeMessageBody(msg, msgType); err != nil {
+	if err := buildMessageBody(&t, msg, msgType); err != nil {
+		return t, err
+	}
+	return t, addKeyOptions(&t, pk, "")
+}
+func buildListTable(msg comm.Message, msgType string) (table, error) {
+	t := newTable(msg.Name, msgType, msg.Name)
+	pk, ok := tablePrimaryKey(msg.Name, msgType)
+	if !ok {
+		return t, fmt.Errorf("write %s message option error, no primary key", msg.Name)
+	}
+	listNum := listMaxNum(msg)
+	if listNum <= 0 {
+		return t, fmt.Errorf("write %s message option error, illegal list max num %d", msg.Name, listNum)
+	}
+	if err := buildMessageBody(&t, msg, msgType); err != nil {
+		return t, err
+	}
+	return t, addKeyOptions(&t, pk, fmt.Sprintf("TableType=LIST;ListNum=%d", listNum))
+}
+
+//add primary key, index, customattr and sharding key options of table
+//keys of source fields are converted to the generated field names
+func addKeyOptions(t *table, pk string, customAttr string) error {
+	var keys []string
+	for _, key := range splitKeys(pk) {
+		keys = append(keys, t.generatedName(key))
+	}
+	pk = strings.Join(keys, ",")
+	t.addOption(primaryKeyOption, pk)
+	if uid := t.generatedName("UID"); t.category == "SPLIT" && isPrimaryKeyField(uid, pk) {
+		//index must be part of primary key
+		t.addOption(indexOption, fmt.Sprintf("index_1(%s)", uid))
+	}
+	if customAttr != "" {
+		t.addOption(customAttrOption, customAttr)
+	}
+	shardingKey, err := tableShardingKey(t, pk)
+	if err != nil {
 		return err
 	}
-	buf.WriteString("}\n")
+	if shardingKey != "" {
+		t.addOption(shardingKeyOption, shardingKey)
+	}
 	return nil
 }
-func writeBlobMessages(msgType string, msgs []string) error {
-	writeProtoFileHead()
-	if msgType == "OUT" {
-		buf.WriteString(fmt.Sprintf("message %v { \n", comm.BlobUserOutMsg))
-		optStr := fmt.Sprintf("\toption(tcaplusservice.tcaplus_primary_key) = \"UID\";\n")
-		buf.WriteString(optStr)
-		buf.WriteString(fmt.Sprintf("\tuint64 UID = 1;\n\tuint64 UpdateTime = 2;\n"))
-		seqId := 3
-		for _, oms := range msgs {
-			buf.WriteString(fmt.Sprintf("\tbytes %v = %d;\n", oms, seqId))
-			seqId = seqId + 1
-		}
-		buf.WriteString("}\n")
-	} else if msgType == "IN" {
-		buf.WriteString(fmt.Sprintf("message %v { \n", comm.BlobUserInMsg))
-		optStr := fmt.Sprintf("\toption(tcaplusservice.tcaplus_primary_key) = \"UID\";\n")
-		buf.WriteString(optStr)
-		buf.WriteString(fmt.Sprintf("\tuint64 UID = 1;\n\tuint64 UpdateTime = 2;\n"))
-		seqId := 3
-		for _, ims := range msgs {
-			buf.WriteString(fmt.Sprintf("\tbytes %v = %d;\n", ims, seqId))
-			seqId = seqId + 1
-		}
-		buf.WriteString("}\n")
+
+//get the max element num of list table, list annotation takes precedence over config
+func listMaxNum(msg comm.Message) int {
+	if class, ok := msgClasses[msg.Name]; ok && class.listNum != "" {
+		num, err := strconv.Atoi(class.listNum)
+		if err != nil {
+			return 0
+		}
+		return num
 	}
-	return nil
+	for _, opt := range msg.Options {
+		if opt.Name == comm.ListAnnotation {
+			num, err := strconv.Atoi(opt.Value)
+			if err != nil {
+				return 0
+			}
+			return num
+		}
+	}
+	if num, ok := comm.ListTableMaxNums[msg.Name]; ok {
+		return num
+	}
+	return comm.ListMaxNum
+}
+
+func buildBlobTable(cat comm.BlobCategory, name string, msgs []string) (table, error) {
+	t := newTable(name, "BLOB", "")
+	columns := blobColumns(cat)
+	pk := columnKeys(columns)
+	if pk == "" {
+		return t, fmt.Errorf("write %s message option error, no primary key", name)
+	}
+	seqId := t.addColumns(columnsAt(columns, "head"), 1) + 1
+	for _, bms := range msgs {
+		//blob column is named after blob message, the same as table name
+		t.addField(comm.Field{ID: seqId, Name: tableName(bms), Type: "bytes"}, bms)
+		seqId = seqId + 1
+	}
+	t.addColumns(columnsAt(columns, "tail"), seqId)
+	return t, addKeyOptions(&t, pk, "")
+}
+
+//get generated sharding key of table, per-table sharding key overrides the sharding key of table category
+//the sharding key must be part of the primary key, empty string returned if no sharding key specified
+func tableShardingKey(t *table, primaryKey string) (string, error) {
+	shardingKey, ok := comm.TableShardingKeys[t.name]
+	if !ok {
+		shardingKey = comm.ShardingKeys[t.category]
+	}
+	if shardingKey == "" {
+		return "", nil
+	}
+	if key := t.generatedName(shardingKey); isPrimaryKeyField(key, primaryKey) {
+		return key, nil
+	}
+	return "", fmt.Errorf("write %s message option error, sharding key %s is not part of primary key %s", t.msg.Name, shardingKey, primaryKey)
 }
 
-func writeMessageBody(msg comm.Message, msgType string) error {
+func buildMessageBody(t *table, msg comm.Message, msgType string) error {
+	columns := injectedColumns(msg.Name, msgType)
+	if err := checkInjectedColumns(msg, columns); err != nil {
+		return err
+	}
+	headColumns := columnsAt(columns, "head")
 	seqIncr := 0
 	maxSeq := 0
+	//keep the field numbers of source message, head columns are put behind all fields
+	preserve := isPreserveNumbers(msgType)
+	keyName := entityKeyName(msg)
+	//options of source message are not generated, except table annotations
+	for _, opt := range msg.Options {
+		if opt.Name != comm.TableAnnotation && opt.Name != comm.ListAnnotation {
+			addWarning(fmt.Sprintf("option %s of %s is dropped", opt.Name, msg.Name))
+		}
+	}
+	if (msgType == "BASE" || msgType == "LIST") && !hasEntityTypeField(msg) && !preserve {
+		//message without EntityType field, head columns are put in front of all fields
+		maxSeq = t.addColumns(headColumns, 1)
+		seqIncr = len(headColumns)
+	}
 	for _, field := range msg.Fields {
-		fieldStr := ""
-
-		if msgType == "BASE" {
-			maxSeq = field.ID
+		source := fmt.Sprintf("%s.%s", msg.Name, field.Name)
+		for _, opt := range field.Options {
+			addWarning(fmt.Sprintf("option %s of %s is dropped", opt.Name, source))
 		}
-
-		if field.Type == "EntityType" {
-			if msgType == "BASE" {
-				//if message is base message, the start sequence id need decrease 1 because of getting rid of EntityType field
-				seqIncr = -1
+		if isEntityMarker(field) {
+			if preserve {
+				//the field number of EntityType is reserved, so that bytes of source message can be read by the table
+				t.msg.ReservedIDs = append(t.msg.ReservedIDs, field.ID)
+			} else if msgType == "BASE" || msgType == "LIST" {
+				//EntityType field is replaced by head columns, the sequence id of following fields need to be adjusted
+				//if no head column, the sequence id decreases 1 because of getting rid of EntityType field
+				maxSeq = t.addColumns(headColumns, field.ID)
+				seqIncr = len(headColumns) - 1
 			}
 			//skip EntityType field
 			continue
 		}
-		if field.Name == "UUID" && (msgType == "SPLIT") {
-			fieldStr = fmt.Sprintf("\t%v %v = 1;\n\tuint64 UID = 2;\n\tuint64 UpdateTime = 3;\n", field.Type, field.Name)
-			buf.WriteString(fieldStr)
-			seqIncr = 1 //increase 1
+		if field.Name == keyName && (msgType == "SPLIT" || msgType == "PUB") {
+			//entity key (UUID) is the first field, followed by head columns
+			t.addField(comm.Field{ID: 1, Name: policyName(field.Name), Type: field.Type}, source)
+			maxSeq = t.addColumns(headColumns, 2)
+			seqIncr = len(headColumns) + 1 - field.ID
 			continue
 		}
-		if field.Name == "UUID" && msgType == "PUB" {
-			fieldStr = fmt.Sprintf("\t%v %v = 1;\n\tuint64 UpdateTime = 2;\n", field.Type, field.Name)
-			buf.WriteString(fieldStr)
-			continue
-		}
-		if field.IsRepeated {
-			fieldStr = "repeated "
-		}
 		newId := field.ID + seqIncr
-		newName := strings.Title(field.Name)
-
-		if ok := isProtoDataType(field.Type); ok {
-			fieldStr = fmt.Sprintf("\t%v%v %v = %v;\n", fieldStr, field.Type, newName, newId)
-		} else if _, ok := isEnumInCommEnums(field.Type); ok {
-			//enum field, nested enums or defined in common proto file (enumm_entity.proto)
-			//convert all enums to int32
-			fieldStr = fmt.Sprintf("\t%vint32 %v = %v;\n", fieldStr, newName, newId)
-			//add enum into temp list
-			//checkAndAppendTempEnums(msgType, *e)
-		} else if ok := isNestedEnum(field.Type, msg); ok {
-			fieldStr = fmt.Sprintf("\t%vint32 %v = %v;\n", fieldStr, newName, newId)
-		} else if ok := isMessageInCommMessages(field.Type); ok {
-			//message (not base, pub, split, and blob message)
-			fieldStr = fmt.Sprintf("\t%vbytes %v = %v;\n", fieldStr, newName, newId)
-		} else if ok := isNestedMessage(field.Type, msg); ok {
-			//nested message field, defined in current message, convert to bytes
-			fieldStr = fmt.Sprintf("\t%vbytes %v = %v;\n", fieldStr, newName, newId)
-		} else if ok := isMessageInSplitMessages(field.Type); ok {
-			//split message nested in pub message or base message
-			fieldStr = fmt.Sprintf("\t%vbytes %v = %v;\n", fieldStr, newName, newId)
-		} else if ok := isMessageInBlobMessages(field.Type); ok {
-			//blob message nested in pub message or base message
-			fieldStr = fmt.Sprintf("\t%vbytes %v = %v;\n", fieldStr, newName, newId)
-		} else {
-			fieldStr = fmt.Sprintf("\t%v%v %v = %v;\n", fieldStr, field.Type, newName, newId)
-		}
-
-		buf.WriteString(fieldStr)
-	}
-
-	//deal with base table rules
-	if msgType == "BASE" && maxSeq != 0 {
-		if msg.Name == "BaseAccounts" {
-			buf.WriteString(fmt.Sprintf("\tuint64 AddTime = %d;\n\tuint64 UpdateTime = %d;\n", maxSeq, maxSeq+1))
-		} else {
-			buf.WriteString(fmt.Sprintf("\tuint64 UpdateTime = %d;\n", maxSeq))
+		newName := policyName(field.Name)
+		if newId > maxSeq {
+			maxSeq = newId
 		}
-
+		t.addField(comm.Field{
+			ID:         newId,
+			Name:       newName,
+			Type:       fieldType(field.Type, msg),
+			IsRepeated: field.IsRepeated,
+		}, source)
 	}
 
 	for _, mapf := range msg.Maps {
 		newId := mapf.Field.ID + seqIncr
-		newName := strings.Title(mapf.Field.Name)
-		buf.WriteString(fmt.Sprintf("\tbytes %v = %v;\n", newName, newId))
+		newName := policyName(mapf.Field.Name)
+		t.addField(comm.Field{ID: newId, Name: newName, Type: "bytes"}, fmt.Sprintf("%s.%s", msg.Name, mapf.Field.Name))
+		if newId > maxSeq {
+			maxSeq = newId
+		}
 	}
-	for _, enumf := range msg.Enums {
-		//deal nested enums
-		writeEnum(enumf)
+	if preserve {
+		maxSeq = t.addColumns(headColumns, maxSeq+1)
 	}
+	if len(msg.Fields) > 0 || len(msg.Maps) > 0 {
+		//tail columns are put behind all fields
+		t.addColumns(columnsAt(columns, "tail"), maxSeq+1)
+	}
+	//deal nested enums
+	t.msg.Enums = append(t.msg.Enums, msg.Enums...)
 
 	/*
 			for _, msgf := range msg.Messages {
@@ -659,6 +865,59 @@ func writeMessageBody(msg comm.Message, msgType string) error {
 	*/
 	return nil
 }
+
+//check whether the field numbers of source message are kept for table category
+func isPreserveNumbers(msgType string) bool {
+	for _, category := range comm.PreserveFieldNumbers {
+		if category == msgType {
+			return true
+		}
+	}
+	return false
+}
+
+//get generated type of source field type, unresolved type is reported as warning
+func fieldType(ftype string, msg comm.Message) string {
+	newType, _, ok := resolveFieldType(ftype, msg)
+	if !ok {
+		addWarning(fmt.Sprintf("type %s used in %s is unresolved, generated as is", ftype, msg.Name))
+	}
+	return newType
+}
+
+//resolve generated type of source field type, the kind of source type is returned, false returned if type is unresolved
+func resolveFieldType(ftype string, msg comm.Message) (string, string, bool) {
+	if ok := isProtoDataType(ftype); ok {
+		return ftype, "scalar", true
+	} else if _, ok := isEnumInCommEnums(ftype); ok {
+		//enum field, nested enums or defined in common proto file (enumm_entity.proto)
+		//convert all enums to int32
+		//add enum into temp list
+		//checkAndAppendTempEnums(msgType, *e)
+		return "int32", "enum", true
+	} else if ok := isNestedEnum(ftype, msg); ok {
+		return "int32", "nested enum", true
+	} else if ok := isMessageInCommMessages(ftype); ok {
+		//message (not base, pub, split, and blob message)
+		return "bytes", "message", true
+	} else if ok := isNestedMessage(ftype, msg); ok {
+		//nested message field, defined in current message, convert to bytes
+		return "bytes", "nested message", true
+	} else if ok := isMessageInSplitMessages(ftype); ok {
+		//split message nested in pub message or base message
+		return "bytes", "split message", true
+	} else if ok := isMessageInBlobMessages(ftype); ok {
+		//blob message nested in pub message or base message
+		return "bytes", "blob message", true
+	} else if ok := isMessageInListMessages(ftype); ok {
+		//list message nested in other message
+		return "bytes", "list message", true
+	} else if name, ok := baseOrPubMessageName(ftype); ok {
+		//base or pub message nested in other message, refer to the generated table
+		return tableName(name), "base or pub message", true
+	}
+	return ftype, "unresolved", false
+}
 func checkAndAppendTempEnums(msgType string, e comm.Enum) {
 	existFlag := 0
 	if es, ok := tempEnums[msgType]; ok {
@@ -737,21 +996,37 @@ func isMessageInSplitMessages(name string) bool {
 
 	return false
 }
-func isMessageInBlobMessages(name string) bool {
+func isMessageInListMessages(name string) bool {
 	replaceStr := fmt.Sprintf("%s.", GeneralPackageName)
-	if strings.HasPrefix(name, "IN_") {
+	for _, m := range listMessages {
+		if name == m.Name {
+			return true
+		}
 		newName := strings.TrimPrefix(name, replaceStr)
-		for _, bn := range blobMessages["IN"] {
-			if name == bn {
-				return true
-			}
-			if newName == bn {
-				return true
+		if newName == m.Name {
+			return true
+		}
+	}
+	return false
+}
+//get source message name of base or pub message type
+func baseOrPubMessageName(name string) (string, bool) {
+	newName := strings.TrimPrefix(name, fmt.Sprintf("%s.", GeneralPackageName))
+	for _, msgs := range [][]comm.Message{baseMessages, pubMessages} {
+		for _, m := range msgs {
+			if name == m.Name || newName == m.Name {
+				return m.Name, true
 			}
 		}
-	} else if strings.HasPrefix(name, "OUT_") {
-		newName := strings.TrimPrefix(name, replaceStr)
-		for _, bn := range blobMessages["OUT"] {
+	}
+	return "", false
+}
+
+func isMessageInBlobMessages(name string) bool {
+	replaceStr := fmt.Sprintf("%s.", GeneralPackageName)
+	newName := strings.TrimPrefix(name, replaceStr)
+	for _, bms := range blobMessages {
+		for _, bn := range bms {
 			if name == bn {
 				return true
 			}
@@ -782,16 +1057,24 @@ func isBaseMessageType(msg comm.Message) bool {
 	}
 	return false
 }
+func isListMessageType(msg comm.Message) bool {
+	//check list message, message feature: LIST prefix with EntityType field, or list annotation `option (tcaplus.list_num) = 1000;`
+	//message will be generated to tcaplusdb list table, each UID holds a list of records
+	for _, opt := range msg.Options {
+		if opt.Name == comm.ListAnnotation {
+			return true
+		}
+	}
+	if comm.ListMessagePrefix != "" && strings.HasPrefix(msg.Name, comm.ListMessagePrefix) && hasEntityTypeField(msg) {
+		return true
+	}
+	return false
+}
 func isBlobMessageType(msg comm.Message) (string, bool) {
-	//check blob message type, message feature: OUT prefix or IN prefix , only has EntityType field without UUID field
-	//message will be added to blob_user_data_out (message with OUT prefix) or blob_user_data_in (message with IN prefix) message
+	//check blob message type, message feature: prefix of blob category (such as OUT_, IN_), only has EntityType field without UUID field
+	//message will be added to blob table of its category, such as blob_user_data_out (message with OUT prefix) or blob_user_data_in (message with IN prefix)
 	// blob message will be converted to bytes type and be  generated to tcaplusdb table
-	blobType := ""
-	if strings.HasPrefix(msg.Name, "OUT_") {
-		blobType = "OUT"
-	} else if strings.HasPrefix(msg.Name, "IN_") {
-		blobType = "IN"
-	}
+	blobType := blobTypeOfName(msg.Name)
 	flag := checkMessageFlag(msg)
 	if blobType != "" && flag == 1 {
 		//is blob message
@@ -800,38 +1083,53 @@ func isBlobMessageType(msg comm.Message) (string, bool) {
 	return "", false
 }
 func isInOrOutMessageType(msg comm.Message) (string, bool) {
-	//check in or out message, message feature: IN_ or OUT_ prefix, both EntityType and UUID exist
-	//message will be generated to tcaplusdb table
-	msgType := ""
-	if strings.HasPrefix(msg.Name, "OUT_") {
-		msgType = "OUT"
-	} else if strings.HasPrefix(msg.Name, "IN_") {
-		msgType = "IN"
-	}
+	//check in or out message, message feature: prefix of split_message_prefixes (IN_ or OUT_), both EntityType and UUID exist
+	//message will be generated to tcaplusdb table, the matched prefix is returned
+	prefix, ok := matchPrefix(msg.Name, comm.SplitMessagePrefixes)
 	flag := checkMessageFlag(msg)
-	if msgType != "" && flag == 2 {
-		return msgType, true
+	if ok && flag == 2 {
+		return prefix, true
 	}
 	return "", false
 }
 func isPubMessageType(msg comm.Message) (string, bool) {
-	//check pub message, message feature: PUB prefix, both EntityType and UUID exist
-	//message will be generated to tcaplusdb table
+	//check pub message, message feature: prefix of pub_message_prefixes (PUB_), both EntityType and UUID exist
+	//message will be generated to tcaplusdb table, the matched prefix is returned
+	prefix, ok := matchPrefix(msg.Name, comm.PubMessagePrefixes)
 	flag := checkMessageFlag(msg)
-	if strings.HasPrefix(msg.Name, "PUB_") && flag == 2 {
-		return "PUB", true
+	if ok && flag == 2 {
+		return prefix, true
+	}
+	return "", false
+}
+
+//get the first prefix of name in prefixes
+func matchPrefix(name string, prefixes []string) (string, bool) {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			return prefix, true
+		}
 	}
 	return "", false
 }
 
+func hasEntityTypeField(msg comm.Message) bool {
+	for _, field := range msg.Fields {
+		if isEntityMarker(field) {
+			return true
+		}
+	}
+	return false
+}
+
 func checkMessageFlag(msg comm.Message) int {
 	flag := 0
 	for _, field := range msg.Fields {
-		if field.Type == "EntityType" {
+		if isEntityMarker(field) {
 			flag = 1
 			continue
 		}
-		if field.Name == "UUID" {
+		if isEntityKey(field) {
 			flag = flag + 1
 			break
 		}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestParseErrorExitCode(t *testing.T) {
+	//stray line in proto file stops the conversion, instead of losing the messages behind it
+	err := convertForTest(t, "testdata/parse_error", t.TempDir())
+	assert.Error(t, err)
+	assert.Equal(t, exitParse, errorCode(err))
+}
+
+func TestAddWarning(t *testing.T) {
+	resetParseState()
+	msg := comm.Message{Name: "OUT_Pet", Options: []comm.Option{{Name: comm.TableAnnotation, Aggregated: []comm.Option{{Name: "kind", Value: "UNKNOWN"}}}}}
+	classifyMessage(msg)
+	classifyMessage(msg)
+	assert.Equal(t, 1, len(warnInfos))
+	strictMode = true
+	defer func() { strictMode = false }()
+	assert.True(t, convertFailed())
+}
+
+func TestDefaultTableNames(t *testing.T) {
+	//without blob_user_*_msg_name, blob tables are named blob_user_data_in and blob_user_data_out as the baseline
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(config, regexp.MustCompile(`(?m)^\s*blob_user_\w+_msg_name = .*\n`).ReplaceAll(data, nil), 0644))
+	dst := t.TempDir()
+	assert.NoError(t, convertWithConfig(t, config, copyTestdata(t), dst))
+	assert.Equal(t, comm.GlobalNamingPolicy, comm.NamingPolicy)
+	for file, name := range map[string]string{"blob_user_data_in.proto": "blob_user_data_in", "blob_user_data_out.proto": "blob_user_data_out"} {
+		out, err := ioutil.ReadFile(filepath.Join(dst, file))
+		assert.NoError(t, err)
+		assert.Contains(t, string(out), "message "+name+" {", file)
+	}
+
+	//table names are kept by title policy, field names are titled
+	assert.Equal(t, "chaos_battle", tableName("chaos_battle"))
+	assert.Equal(t, "OUT_ChaosBattle", tableName("OUT_ChaosBattle"))
+	assert.Equal(t, "Chaos_battle", policyName("chaos_battle"))
+}
+
+func TestListTables(t *testing.T) {
+	//max element num by list_num annotation, per-table config and default
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	customAttrs := map[string]string{}
+	for _, tb := range tables[comm.TableFiles["LIST"]] {
+		assert.Equal(t, "UID", tb.option(primaryKeyOption), tb.name)
+		customAttrs[tb.name] = tb.option(customAttrOption)
+	}
+	assert.Equal(t, map[string]string{"LIST_Mail": "TableType=LIST;ListNum=1000", "BattleLog": "TableType=LIST;ListNum=200"}, customAttrs)
+	out, err := ioutil.ReadFile(filepath.Join(dst, "table_list_message.proto"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "message LIST_Mail{\n\toption(tcaplusservice.tcaplus_primary_key) = \"UID\";\n\toption(tcaplusservice.tcaplus_customattr) = \"TableType=LIST;ListNum=1000\";\n")
+
+	var mail comm.Message
+	for _, msg := range listMessages {
+		if msg.Name == "LIST_Mail" {
+			mail = msg
+		}
+	}
+	defer comm.ResetConfig()
+	comm.ListTableMaxNums = map[string]int{"LIST_Mail": 300}
+	tb, err := buildListTable(mail, "LIST")
+	assert.NoError(t, err)
+	assert.Equal(t, "TableType=LIST;ListNum=300", tb.option(customAttrOption))
+	comm.ListTableMaxNums = map[string]int{"LIST_Mail": 0}
+	_, err = buildListTable(mail, "LIST")
+	assert.EqualError(t, err, "write LIST_Mail message option error, illegal list max num 0")
+}
+
+func TestListMessagesWithoutListFile(t *testing.T) {
+	//list messages are reported instead of dropped silently, and no result of list proto file is printed
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(config, regexp.MustCompile(`, LIST:table_list_message.proto`).ReplaceAll(data, nil), 0644))
+	src, dst := copyTestdata(t), t.TempDir()
+	out := captureOutput(t, func() {
+		assert.NoError(t, convertWithConfig(t, config, src, dst))
+	})
+	assert.Equal(t, []string{"list messages LIST_Mail,BattleLog are ignored, no LIST proto file in table_proto_files"}, warnInfos)
+	assert.NotContains(t, out, "[.]")
+	assert.NotContains(t, out, "table_list_message.proto")
+	assert.Equal(t, []string{"base.proto", "table_pub_message.proto", "table_split_message.proto",
+		"blob_user_data_in.proto", "blob_user_data_out.proto", "blob_user_data_social.proto"}, outputProtoFiles())
+}
+
+func TestClassifyByAnnotation(t *testing.T) {
+	resetParseState()
+	cfgFile = "config/proto_parse.cfg"
+	assert.NoError(t, loadConfig())
+	entity := []comm.Field{{ID: 1, Name: "dType", Type: "EntityType"}, {ID: 2, Name: "UUID", Type: "uint64"}}
+	annotation := func(items ...string) []comm.Option {
+		opt := comm.Option{Name: comm.TableAnnotation}
+		for i := 0; i < len(items); i += 2 {
+			opt.Aggregated = append(opt.Aggregated, comm.Option{Name: items[i], Value: items[i+1]})
+		}
+		return []comm.Option{opt}
+	}
+	cases := []struct {
+		name  string
+		msg   comm.Message
+		class msgClass
+		warn  string
+	}{
+		{"annotation without naming rule", comm.Message{Name: "Guild", Options: annotation("kind", "PUB", "keys", "UUID"), Fields: entity},
+			msgClass{kind: "PUB", keys: "UUID", rule: "(tcaplus.table) annotation"}, ""},
+		{"annotation agrees with naming rule", comm.Message{Name: "PUB_Guild", Options: annotation("kind", "pub"), Fields: entity},
+			msgClass{kind: "PUB", rule: "(tcaplus.table) annotation"}, ""},
+		{"blob type of name prefix", comm.Message{Name: "OUT_Bag", Options: annotation("kind", "BLOB"), Fields: entity[:1]},
+			msgClass{kind: "BLOB", blobType: "OUT", rule: "(tcaplus.table) annotation"}, ""},
+		{"list num", comm.Message{Name: "Log", Options: annotation("kind", "LIST", "list_num", "200"), Fields: entity[:1]},
+			msgClass{kind: "LIST", listNum: "200", rule: "(tcaplus.table) annotation"}, ""},
+		{"list annotation", comm.Message{Name: "Log", Options: []comm.Option{{Name: comm.ListAnnotation, Value: "200"}}, Fields: entity[:1]},
+			msgClass{kind: "LIST", rule: "list rule"}, ""},
+		{"annotation conflicts with naming rule", comm.Message{Name: "PUB_Guild", Options: annotation("kind", "SPLIT"), Fields: entity},
+			msgClass{kind: "SPLIT", rule: "(tcaplus.table) annotation"}, "PUB_Guild annotated as SPLIT conflicts with pub rule (PUB), annotation is used"},
+		{"blob type conflicts with name prefix", comm.Message{Name: "OUT_Bag", Options: annotation("kind", "BLOB", "blob", "IN"), Fields: entity[:1]},
+			msgClass{kind: "BLOB", blobType: "IN", rule: "(tcaplus.table) annotation"}, "OUT_Bag annotated as BLOB(IN) conflicts with blob rule (BLOB(OUT)), annotation is used"},
+		{"invalid annotation is ignored", comm.Message{Name: "PUB_Guild", Options: annotation("kind", "TABLE"), Fields: entity},
+			msgClass{kind: "PUB", rule: "pub rule"}, "PUB_Guild table annotation error: unknown kind TABLE, classified by pub rule"},
+		{"keys of blob message", comm.Message{Name: "OUT_Bag", Options: annotation("kind", "BLOB", "keys", "UID"), Fields: entity[:1]},
+			msgClass{kind: "BLOB", blobType: "OUT", rule: "blob rule"},
+			"OUT_Bag table annotation error: keys specified for BLOB kind, specify keys of blob category in blob_proto_files, classified by blob rule"},
+	}
+	for _, c := range cases {
+		warnInfos = nil
+		assert.Equal(t, c.class, classifyMessage(c.msg), c.name)
+		if c.warn == "" {
+			assert.Empty(t, warnInfos, c.name)
+		} else {
+			assert.Equal(t, []string{c.warn}, warnInfos, c.name)
+		}
+	}
+}
+
+func TestAnnotationProto(t *testing.T) {
+	//options read by the tool are declared by the shipped extension proto file
+	reader, err := os.Open("proto/tcaplus.proto")
+	assert.NoError(t, err)
+	defer reader.Close()
+	definition, err := proto.NewParser(reader).Parse()
+	assert.NoError(t, err)
+	var pkg string
+	var extensions, kinds []string
+	proto.Walk(definition,
+		proto.WithPackage(func(p *proto.Package) {
+			pkg = p.Name
+		}),
+		proto.WithMessage(func(m *proto.Message) {
+			if m.IsExtend {
+				for _, e := range m.Elements {
+					if f, ok := e.(*proto.NormalField); ok {
+						extensions = append(extensions, "("+pkg+"."+f.Name+")")
+					}
+				}
+			}
+		}),
+		proto.WithEnum(func(e *proto.Enum) {
+			for _, el := range e.Elements {
+				if v, ok := el.(*proto.EnumField); ok && v.Integer != 0 {
+					kinds = append(kinds, v.Name)
+				}
+			}
+		}))
+	assert.Equal(t, []string{comm.TableAnnotation, comm.ListAnnotation}, extensions)
+	assert.Equal(t, annotationKinds, kinds)
+}
+
+func TestEntityKeyTypes(t *testing.T) {
+	resetParseState()
+	cfgFile = "config/proto_parse.cfg"
+	assert.NoError(t, loadConfig())
+	defer comm.ResetConfig()
+	msg := comm.Message{Name: "OUT_Bag", Fields: []comm.Field{{ID: 1, Name: "dType", Type: "EntityType"}, {ID: 2, Name: "UUID", Type: "bytes"}}}
+	//key of any type is entity key without entity_key_types, the same as baseline
+	assert.Equal(t, msgClass{kind: "SPLIT", rule: "split rule"}, classifyMessage(msg))
+	assert.Empty(t, warnInfos)
+
+	comm.EntityKeyTypes = []string{"uint64", "string"}
+	assert.Equal(t, msgClass{kind: "BLOB", blobType: "OUT", rule: "blob rule"}, classifyMessage(msg))
+	assert.Equal(t, []string{
+		"OUT_Bag classified as BLOB(OUT) by blob rule instead of SPLIT by split rule, as entity key type is not one of entity_key_types",
+		"OUT_Bag classified as BLOB(OUT) by blob rule, key field UUID type bytes is not one of entity_key_types",
+	}, warnInfos)
+	assert.Equal(t, []string{"uint64", "string"}, comm.EntityKeyTypes)
+
+	//allowed key type classifies the same as baseline
+	warnInfos = nil
+	msg.Fields[1].Type = "uint64"
+	assert.Equal(t, msgClass{kind: "SPLIT", rule: "split rule"}, classifyMessage(msg))
+	assert.Empty(t, warnInfos)
+}
+
+func TestInjectedColumns(t *testing.T) {
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	//key column at tail of category, columns of table replacing its category, and column conflicting with source field
+	cfg := strings.NewReplacer(
+		`PUB = "UpdateTime:uint64:head"`, `PUB = "UpdateTime:uint64:head, Zone:uint32:tail:key"`+"\n    OUT_BattlePass = \"updateTime:uint64:tail\"",
+		`BASE = "UpdateTime:uint64:tail"`, `BASE = "UpdateTime:uint64:tail, Version:uint32:tail"`,
+	).Replace(string(data))
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(config, []byte(cfg), 0644))
+	assert.NoError(t, convertWithConfig(t, config, copyTestdata(t), t.TempDir()))
+
+	fieldNames := func(tb table) []string {
+		var names []string
+		for _, field := range tb.msg.Fields {
+			names = append(names, fmt.Sprintf("%d:%s", field.ID, field.Name))
+		}
+		return names
+	}
+	pub, ok := findTable("PUB_ChaosBattle")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"1:UUID", "2:UpdateTime", "3:Users", "4:Winner", "5:InChaosBattle", "6:Zone"}, fieldNames(pub))
+	assert.Equal(t, "UUID,Zone", pub.option(primaryKeyOption))
+
+	split, ok := findTable("OUT_BattlePass")
+	assert.True(t, ok)
+	assert.Equal(t, "UUID", split.option(primaryKeyOption))
+	assert.Equal(t, "", split.option(indexOption))
+	assert.Equal(t, "UpdateTime", split.msg.Fields[len(split.msg.Fields)-1].Name)
+	assert.Equal(t, injectedSource, split.fieldSources["UpdateTime"])
+
+	assert.Equal(t, "write BaseVersion message error, injected column Version conflicts with field version", errorInfos["base.proto"])
+}
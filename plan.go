@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//phases of migration plan, steps are executed in the order of phases
+const (
+	//in-place changes applied before deploying new version, no downtime
+	phaseOnline string = "online"
+	//tables rebuilt with data copy, writes to the tables are stopped
+	phaseDowntime string = "downtime"
+	//removed tables dropped after new version deployed
+	phaseCleanup string = "cleanup"
+)
+
+//file names of migration plan
+const (
+	planMarkdownFile string = "migration_plan.md"
+	planJSONFile     string = "migration_plan.json"
+)
+
+//step of migration plan
+type planStep struct {
+	Order  int    `json:"order"`
+	Phase  string `json:"phase"`
+	Action string `json:"action"`
+	Table  string `json:"table"`
+	//proto file of table
+	File     string `json:"file,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Detail   string `json:"detail"`
+	Downtime bool   `json:"downtime"`
+}
+
+//migration plan from old schema to new schema
+type migrationPlan struct {
+	Old   string     `json:"old"`
+	New   string     `json:"new"`
+	Steps []planStep `json:"steps"`
+}
+
+func (p *migrationPlan) addStep(step planStep) {
+	step.Order = len(p.Steps) + 1
+	step.Downtime = step.Phase == phaseDowntime
+	p.Steps = append(p.Steps, step)
+}
+
+//build migration plan with the changes between two schemas
+//tables with breaking changes are rebuilt: writes are stopped, data is exported, the table is recreated with new schema and data is copied back
+func buildMigrationPlan(oldSchema map[string]schemaTable, newSchema map[string]schemaTable) migrationPlan {
+	var plan migrationPlan
+	//changes of each table, key: table name
+	tableChanges := map[string][]schemaChange{}
+	var names []string
+	for _, c := range diffSchemas(oldSchema, newSchema) {
+		if _, ok := tableChanges[c.table]; !ok {
+			names = append(names, c.table)
+		}
+		tableChanges[c.table] = append(tableChanges[c.table], c)
+	}
+	sort.Strings(names)
+
+	var rebuilds, drops []string
+	for _, name := range names {
+		changes := tableChanges[name]
+		switch {
+		case changes[0].kind == tableAdded:
+			plan.addStep(planStep{Phase: phaseOnline, Action: "create_table", Table: name, File: newSchema[name].file,
+				Detail: fmt.Sprintf("create table %s with %d fields", name, len(newSchema[name].msg.Fields))})
+		case changes[0].kind == tableRemoved:
+			drops = append(drops, name)
+		case hasBreakingChange(changes):
+			rebuilds = append(rebuilds, name)
+		default:
+			for _, c := range changes {
+				step := planStep{Phase: phaseOnline, Table: name, File: newSchema[name].file, Field: c.field, Detail: c.detail}
+				switch c.kind {
+				case fieldAdded:
+					step.Action = "add_field"
+				case fieldRemoved:
+					step.Action = "remove_field"
+				default:
+					step.Action = "update_proto"
+				}
+				plan.addStep(step)
+			}
+		}
+	}
+	for _, name := range rebuilds {
+		file := newSchema[name].file
+		var reasons []string
+		for _, c := range tableChanges[name] {
+			if !c.breaking {
+				continue
+			}
+			if c.field != "" {
+				reasons = append(reasons, fmt.Sprintf("%s %s", c.field, c.detail))
+			} else {
+				reasons = append(reasons, c.detail)
+			}
+		}
+		copyDetail := fmt.Sprintf("convert exported records of %s to new schema and import them, fields are mapped by name", name)
+		if renames := renamedFields(oldSchema[name].msg, newSchema[name].msg); len(renames) > 0 {
+			copyDetail = fmt.Sprintf("%s, renamed fields are mapped by number: %s", copyDetail, strings.Join(renames, ", "))
+		}
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "stop_writes", Table: name, File: file,
+			Detail: fmt.Sprintf("stop writes to %s, breaking changes: %s", name, strings.Join(reasons, "; "))})
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "export_data", Table: name, File: oldSchema[name].file,
+			Detail: fmt.Sprintf("export records of %s with old schema", name)})
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "drop_table", Table: name, File: oldSchema[name].file,
+			Detail: fmt.Sprintf("drop table %s with old schema", name)})
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "create_table", Table: name, File: file,
+			Detail: fmt.Sprintf("create table %s with new schema", name)})
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "copy_data", Table: name, File: file,
+			Detail: copyDetail})
+		plan.addStep(planStep{Phase: phaseDowntime, Action: "resume_writes", Table: name, File: file,
+			Detail: fmt.Sprintf("resume writes to %s", name)})
+	}
+	for _, name := range drops {
+		file := oldSchema[name].file
+		plan.addStep(planStep{Phase: phaseCleanup, Action: "export_data", Table: name, File: file,
+			Detail: fmt.Sprintf("archive records of removed table %s", name)})
+		plan.addStep(planStep{Phase: phaseCleanup, Action: "drop_table", Table: name, File: file,
+			Detail: fmt.Sprintf("drop table %s after new version deployed", name)})
+	}
+	return plan
+}
+
+//get fields renamed with the same field number, such as `OUT_Pet -> Pet`
+func renamedFields(oldMsg comm.Message, newMsg comm.Message) []string {
+	var renames []string
+	for _, oldField := range oldMsg.Fields {
+		for _, newField := range newMsg.Fields {
+			if oldField.ID == newField.ID && oldField.Name != newField.Name && !hasField(newMsg, oldField.Name) {
+				renames = append(renames, fmt.Sprintf("%s -> %s", oldField.Name, newField.Name))
+			}
+		}
+	}
+	return renames
+}
+
+func hasField(msg comm.Message, name string) bool {
+	for _, field := range msg.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBreakingChange(changes []schemaChange) bool {
+	for _, c := range changes {
+		if c.breaking {
+			return true
+		}
+	}
+	return false
+}
+
+//render migration plan as markdown
+func planMarkdown(plan migrationPlan) []byte {
+	var b bytes.Buffer
+	b.WriteString("# TcaplusDB Migration Plan\n\n")
+	b.WriteString(fmt.Sprintf("- old schema: `%s`\n- new schema: `%s`\n", plan.Old, plan.New))
+	if len(plan.Steps) == 0 {
+		b.WriteString("\nNo schema changes.\n")
+		return b.Bytes()
+	}
+	titles := map[string]string{
+		phaseOnline:   "Online Changes",
+		phaseDowntime: "Changes Requiring Downtime",
+		phaseCleanup:  "Cleanup",
+	}
+	phase := ""
+	for _, step := range plan.Steps {
+		if step.Phase != phase {
+			phase = step.Phase
+			b.WriteString(fmt.Sprintf("\n## %s\n\n", titles[phase]))
+		}
+		location := step.Table
+		if step.Field != "" {
+			location = fmt.Sprintf("%s.%s", step.Table, step.Field)
+		}
+		b.WriteString(fmt.Sprintf("%d. **%s** `%s`", step.Order, step.Action, location))
+		if step.File != "" {
+			b.WriteString(fmt.Sprintf(" (%s)", step.File))
+		}
+		b.WriteString(fmt.Sprintf(": %s\n", step.Detail))
+	}
+	return b.Bytes()
+}
+
+//write migration plan between generated proto files of two directories into output directory, as markdown and json
+func WriteMigrationPlan(oldDir string, newDir string, outDir string) error {
+	oldSchema, err := loadSchema(oldDir)
+	if err != nil {
+		return fmt.Errorf("load %s error: %v", oldDir, err)
+	}
+	newSchema, err := loadSchema(newDir)
+	if err != nil {
+		return fmt.Errorf("load %s error: %v", newDir, err)
+	}
+	plan := buildMigrationPlan(oldSchema, newSchema)
+	plan.Old = oldDir
+	plan.New = newDir
+	if plan.Steps == nil {
+		plan.Steps = []planStep{}
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("write migration plan error: %v", err)
+	}
+	outputs := map[string][]byte{
+		planMarkdownFile: planMarkdown(plan),
+		planJSONFile:     append(data, '\n'),
+	}
+	for _, name := range []string{planMarkdownFile, planJSONFile} {
+		file := filepath.Join(outDir, name)
+		if err := ioutil.WriteFile(file, outputs[name], 0644); err != nil {
+			return fmt.Errorf("write migration plan error: %v", err)
+		}
+		fmt.Printf("Generated plan: %s\n", file)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestBuildMigrationPlan(t *testing.T) {
+	key := []comm.Option{{Name: primaryKeyOption, Value: "UID"}}
+	table := func(file string, fields ...comm.Field) schemaTable {
+		return schemaTable{file: file, msg: comm.Message{Options: key, Fields: fields}}
+	}
+	uid := comm.Field{ID: 1, Name: "UID", Type: "uint64"}
+	level := comm.Field{ID: 2, Name: "Level", Type: "uint32"}
+	cases := []struct {
+		name      string
+		oldSchema map[string]schemaTable
+		newSchema map[string]schemaTable
+		//phase and action of each step
+		steps []string
+	}{
+		{"no change", map[string]schemaTable{"T": table("t.proto", uid)}, map[string]schemaTable{"T": table("t.proto", uid)}, nil},
+		{"table added", nil, map[string]schemaTable{"T": table("t.proto", uid)}, []string{"online create_table"}},
+		{"field added", map[string]schemaTable{"T": table("t.proto", uid)}, map[string]schemaTable{"T": table("t.proto", uid, level)},
+			[]string{"online add_field"}},
+		{"table moved", map[string]schemaTable{"T": table("a.proto", uid)}, map[string]schemaTable{"T": table("b.proto", uid)},
+			[]string{"online update_proto"}},
+		{"field type changed", map[string]schemaTable{"T": table("t.proto", uid, level)},
+			map[string]schemaTable{"T": table("t.proto", uid, comm.Field{ID: 2, Name: "Level", Type: "uint64"})},
+			[]string{"downtime stop_writes", "downtime export_data", "downtime drop_table", "downtime create_table", "downtime copy_data", "downtime resume_writes"}},
+		{"table removed", map[string]schemaTable{"T": table("t.proto", uid)}, nil, []string{"cleanup export_data", "cleanup drop_table"}},
+		//online steps go first, then rebuilds, and drops at last, whatever the order of table names
+		{"phases in order", map[string]schemaTable{"A": table("t.proto", uid), "B": table("t.proto", uid, level)},
+			map[string]schemaTable{"B": table("t.proto", uid), "C": table("t.proto", uid)},
+			[]string{"online create_table", "downtime stop_writes", "downtime export_data", "downtime drop_table", "downtime create_table",
+				"downtime copy_data", "downtime resume_writes", "cleanup export_data", "cleanup drop_table"}},
+	}
+	for _, c := range cases {
+		plan := buildMigrationPlan(c.oldSchema, c.newSchema)
+		var steps []string
+		for i, step := range plan.Steps {
+			steps = append(steps, step.Phase+" "+step.Action)
+			assert.Equal(t, i+1, step.Order, c.name)
+			assert.Equal(t, step.Phase == phaseDowntime, step.Downtime, c.name)
+		}
+		assert.Equal(t, c.steps, steps, c.name)
+	}
+}
+
+func TestRenamedFields(t *testing.T) {
+	oldMsg := comm.Message{Fields: []comm.Field{{ID: 1, Name: "UID"}, {ID: 2, Name: "OUT_Pet"}}}
+	newMsg := comm.Message{Fields: []comm.Field{{ID: 1, Name: "UID"}, {ID: 2, Name: "Pet"}}}
+	assert.Equal(t, []string{"OUT_Pet -> Pet"}, renamedFields(oldMsg, newMsg))
+	assert.Nil(t, renamedFields(oldMsg, oldMsg))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+//formats of parse results report
+const (
+	reportText string = "text"
+	reportJSON string = "json"
+)
+
+//kinds of report error
+const (
+	//no messages of blob category
+	errorNoBlobMessages string = "no_blob_messages"
+	//table failed to build from message
+	errorBuild string = "build_error"
+	//table violates tcaplusdb engine limits
+	errorViolation string = "limit_violation"
+	//generated proto file failed to write
+	errorWrite string = "write_error"
+)
+
+//error of generated proto file in report
+type reportError struct {
+	Kind   string `json:"kind"`
+	Table  string `json:"table,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Source string `json:"source,omitempty"`
+	Detail string `json:"detail"`
+}
+
+//generated table in report
+type reportTable struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	//primary key fields, comma separates each field
+	PrimaryKey string `json:"primary_key"`
+	//source messages, blob table has a source message for each column
+	Sources []string `json:"sources"`
+	Fields  int      `json:"fields"`
+}
+
+//generated proto file in report
+type reportOutputFile struct {
+	File   string        `json:"file"`
+	Status string        `json:"status"`
+	Tables []reportTable `json:"tables"`
+	Errors []reportError `json:"errors"`
+}
+
+//classification of source message in report
+type reportMessage struct {
+	Name string `json:"name"`
+	//source proto file
+	File     string `json:"file"`
+	Kind     string `json:"kind"`
+	BlobType string `json:"blob_type,omitempty"`
+	//the rule which decides the kind
+	Rule string `json:"rule"`
+	//generated table and proto file, empty if message is not generated to table
+	Table      string `json:"table,omitempty"`
+	OutputFile string `json:"output_file,omitempty"`
+}
+
+//parse results report
+type parseReport struct {
+	Success  bool               `json:"success"`
+	Files    []reportOutputFile `json:"files"`
+	Messages []reportMessage    `json:"messages"`
+	Warnings []string           `json:"warnings"`
+}
+
+//build report with parse results of current run
+func buildReport() parseReport {
+	r := parseReport{Success: !convertFailed(), Files: []reportOutputFile{}, Messages: []reportMessage{}, Warnings: []string{}}
+	for _, file := range outputProtoFiles() {
+		filename := path.Base(file)
+		rf := reportOutputFile{File: filename, Status: "SUCCESS", Tables: []reportTable{}, Errors: []reportError{}}
+		if _, ok := errorInfos[filename]; ok {
+			rf.Status = "FAIL"
+		}
+		for _, t := range tables[file] {
+			rt := reportTable{Name: t.msg.Name, Category: t.category, PrimaryKey: t.option(primaryKeyOption), Sources: []string{}, Fields: len(t.msg.Fields)}
+			if t.source != "" {
+				rt.Sources = append(rt.Sources, t.source)
+			} else {
+				for _, field := range t.msg.Fields {
+					if source, ok := t.fieldSources[field.Name]; ok && source != injectedSource {
+						rt.Sources = append(rt.Sources, source)
+					}
+				}
+			}
+			rf.Tables = append(rf.Tables, rt)
+		}
+		rf.Errors = append(rf.Errors, fileErrors[file]...)
+		for _, v := range violations {
+			if v.file == file {
+				rf.Errors = append(rf.Errors, reportError{Kind: errorViolation, Table: v.table, Field: v.field, Source: v.source, Detail: v.detail})
+			}
+		}
+		r.Files = append(r.Files, rf)
+	}
+
+	//source proto file of each message
+	msgFiles := map[string]string{}
+	for filename, info := range protoInfos {
+		for _, msg := range info.msgs {
+			msgFiles[msg.Name] = filename
+		}
+	}
+	var names []string
+	for name := range msgClasses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		class := msgClasses[name]
+		outputFile, table := messageTable(name)
+		r.Messages = append(r.Messages, reportMessage{Name: name, File: msgFiles[name], Kind: class.kind, BlobType: class.blobType,
+			Rule: class.rule, Table: table, OutputFile: outputFile})
+	}
+	r.Warnings = append(r.Warnings, warnInfos...)
+	return r
+}
+
+//write json report of parse results into file, or standard output if file is empty
+func writeReport(file string) error {
+	data, err := json.MarshalIndent(buildReport(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("write report error: %v", err)
+	}
+	data = append(data, '\n')
+	if file == "" {
+		_, err = reportOutput.Write(data)
+	} else {
+		err = ioutil.WriteFile(file, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("write report error: %v", err)
+	}
+	return nil
+}
+
+//output of json report printed to standard output, other output is redirected to standard error
+var reportOutput = os.Stdout
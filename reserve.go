@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//columns and reserved entries of generated table saved in lock file
+type lockTable struct {
+	//key: column name, value: field number
+	Fields     map[string]int `json:"fields"`
+	PrimaryKey string         `json:"primary_key,omitempty"`
+	//key: column name, value: source field or blob message of column, column of the same source with another name is renamed
+	Sources       map[string]string `json:"sources,omitempty"`
+	ReservedIDs   []int             `json:"reserved_ids,omitempty"`
+	ReservedNames []string          `json:"reserved_names,omitempty"`
+}
+
+//get columns and reserved entries of table
+func newLockTable(msg comm.Message) lockTable {
+	lt := lockTable{Fields: map[string]int{}, PrimaryKey: messageOption(msg, primaryKeyOption)}
+	for _, field := range msg.Fields {
+		lt.Fields[field.Name] = field.ID
+	}
+	lt.ReservedIDs = append(lt.ReservedIDs, msg.ReservedIDs...)
+	lt.ReservedNames = append(lt.ReservedNames, msg.ReservedNames...)
+	return lt
+}
+
+//get sources of columns, injected columns have no source
+func columnSources(t table) map[string]string {
+	sources := map[string]string{}
+	for _, field := range t.msg.Fields {
+		if source, ok := t.fieldSources[field.Name]; ok && source != injectedSource {
+			sources[field.Name] = source
+		}
+	}
+	return sources
+}
+
+//get previous tables, tables in lock file are preferred, otherwise tables in previous output of destination path are used
+func previousTables(dstPath string) (map[string]lockTable, error) {
+	prev := map[string]lockTable{}
+	if info, err := os.Stat(dstPath); err == nil && info.IsDir() {
+		schema, err := loadSchema(dstPath)
+		if err != nil {
+			return nil, fmt.Errorf("load previous output %s error: %v", dstPath, err)
+		}
+		for name, st := range schema {
+			prev[name] = newLockTable(st.msg)
+		}
+	}
+	for name, lt := range lock.Tables {
+		prev[name] = lt
+	}
+	return prev, nil
+}
+
+//reserve numbers and names of columns removed since previous run, so that they are not reused by later fields
+//reserved entries of previous run are kept, and a warning is reported if a removed column is part of primary key
+func reserveRemovedFields(dstPath string) error {
+	prev, err := previousTables(dstPath)
+	if err != nil {
+		return err
+	}
+	for file := range tables {
+		for i := range tables[file] {
+			t := &tables[file][i]
+			p, ok := prev[t.msg.Name]
+			if !ok {
+				continue
+			}
+			ids := append([]int{}, p.ReservedIDs...)
+			names := append([]string{}, p.ReservedNames...)
+			for name, id := range p.Fields {
+				if hasField(t.msg, name) {
+					continue
+				}
+				ids = append(ids, id)
+				names = append(names, name)
+				if containsString(splitKeys(p.PrimaryKey), name) {
+					warn := fmt.Sprintf("key field %s of primary key %q removed from %s, it changes the table identity", name, p.PrimaryKey, t.msg.Name)
+					if pk := t.option(primaryKeyOption); pk != p.PrimaryKey {
+						warn = fmt.Sprintf("%s, primary key is %q now", warn, pk)
+					}
+					addWarning(warn)
+				}
+			}
+			t.msg.ReservedIDs = mergeInts(t.msg.ReservedIDs, ids)
+			t.msg.ReservedNames = mergeStrings(t.msg.ReservedNames, names)
+			t.msg.ReservedIDs = mergeInts(t.msg.ReservedIDs, keepPreviousNumbers(t, p))
+		}
+	}
+	//tables of current run are saved, tables removed are kept to reserve their columns if added back
+	for _, ts := range tables {
+		for _, t := range ts {
+			lt := newLockTable(t.msg)
+			lt.Sources = columnSources(t)
+			lock.Tables[t.msg.Name] = lt
+		}
+	}
+	return nil
+}
+
+//keep the field numbers of columns in previous run, so that columns moved by removed fields, such as tail columns, read the same data
+//field numbers of source fields are kept instead if the table category preserves field numbers
+//new columns and columns conflicting with others are numbered after all used and reserved numbers
+//previous numbers of renumbered columns are returned to be reserved, or reported as warning if reused by other columns
+func keepPreviousNumbers(t *table, p lockTable) []int {
+	preserve := isPreserveNumbers(t.category)
+	used := map[int]bool{}
+	maxID := 0
+	for _, id := range t.msg.ReservedIDs {
+		used[id] = true
+		if id > maxID {
+			maxID = id
+		}
+	}
+	//numbers wanted by each field, 0 means the field is renumbered
+	//fields with fixed numbers take their numbers first, then new fields take their numbers if not used
+	wanted := make([]int, len(t.msg.Fields))
+	for _, fixed := range []bool{true, false} {
+		for i, field := range t.msg.Fields {
+			id, ok := p.Fields[field.Name]
+			if preserve && t.fieldSources[field.Name] != injectedSource {
+				id, ok = field.ID, true
+			}
+			if ok != fixed {
+				continue
+			}
+			if !ok {
+				id = field.ID
+			}
+			if used[id] {
+				continue
+			}
+			used[id] = true
+			wanted[i] = id
+			if id > maxID {
+				maxID = id
+			}
+		}
+	}
+	for i := range t.msg.Fields {
+		if wanted[i] == 0 {
+			maxID++
+			wanted[i] = maxID
+		}
+		t.msg.Fields[i].ID = wanted[i]
+	}
+	var reserved []int
+	for _, field := range t.msg.Fields {
+		prevID, ok := p.Fields[field.Name]
+		if !ok || prevID == field.ID {
+			continue
+		}
+		if user := fieldByNumber(t.msg, prevID); user != "" {
+			addWarning(fmt.Sprintf("field number %d of %s in %s is reused by %s, %s is numbered %d now", prevID, field.Name, t.msg.Name, user, field.Name, field.ID))
+		} else {
+			reserved = append(reserved, prevID)
+		}
+	}
+	return reserved
+}
+
+//get name of field with number, empty string returned if number is not used
+func fieldByNumber(msg comm.Message, id int) string {
+	for _, field := range msg.Fields {
+		if field.ID == id {
+			return field.Name
+		}
+	}
+	return ""
+}
+
+//merge numbers without duplicates, the result is sorted
+func mergeInts(a []int, b []int) []int {
+	var ret []int
+	for _, i := range append(append([]int{}, a...), b...) {
+		if !containsInt(ret, i) {
+			ret = append(ret, i)
+		}
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+//merge names without duplicates, the result is sorted
+func mergeStrings(a []string, b []string) []string {
+	var ret []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !containsString(ret, s) {
+			ret = append(ret, s)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveRemovedLastField(t *testing.T) {
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, map[string]int{"Token": 1, "RoleInfo": 2, "AccountInfo": 3, "AddTime": 4, "UpdateTime": 5}, fieldNumbers(t, dst, "BaseAccounts"))
+
+	//remove the last business field, tail columns keep their numbers
+	editFile(t, filepath.Join(src, "base.proto"), func(s string) string {
+		return regexp.MustCompile(`(?m)^.*accountInfo.*\n`).ReplaceAllString(s, "")
+	})
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, convertForTest(t, src, dst))
+		assert.False(t, convertFailed(), "%v", errorInfos)
+		assert.Equal(t, map[string]int{"Token": 1, "RoleInfo": 2, "AddTime": 4, "UpdateTime": 5}, fieldNumbers(t, dst, "BaseAccounts"))
+		assert.Equal(t, []int{3}, lock.Tables["BaseAccounts"].ReservedIDs)
+	}
+
+	//new field is numbered after used and reserved numbers, instead of taking the number of tail column
+	editFile(t, filepath.Join(src, "base.proto"), func(s string) string {
+		return regexp.MustCompile(`(?m)^(.*roleInfo.*\n)`).ReplaceAllString(s, "${1}    string extra = 5;\n")
+	})
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, map[string]int{"Token": 1, "RoleInfo": 2, "Extra": 6, "AddTime": 4, "UpdateTime": 5}, fieldNumbers(t, dst, "BaseAccounts"))
+}
+
+func TestReserveRenumberedField(t *testing.T) {
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+
+	//field renumbered in source keeps its number in generated table
+	editFile(t, filepath.Join(src, "base.proto"), func(s string) string {
+		return regexp.MustCompile(`string token\s*= 2;`).ReplaceAllString(s, "string token = 9;")
+	})
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, 1, fieldNumbers(t, dst, "BaseAccounts")["Token"])
+}
+
+func TestReservePreservedNumber(t *testing.T) {
+	configSets = []string{"preserve_field_numbers=BASE"}
+	defer func() { configSets = nil }()
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, 2, fieldNumbers(t, dst, "BaseAccounts")["Token"])
+
+	//field renumbered in source is renumbered in generated table, the previous number is reserved
+	editFile(t, filepath.Join(src, "base.proto"), func(s string) string {
+		return regexp.MustCompile(`string token\s*= 2;`).ReplaceAllString(s, "string token = 9;")
+	})
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, 9, fieldNumbers(t, dst, "BaseAccounts")["Token"])
+	assert.Contains(t, lock.Tables["BaseAccounts"].ReservedIDs, 2)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//demo config, the config template written by init command is made from it
+//go:embed config/proto_parse.cfg
+var demoConfig string
+
+//name prefix of candidate base tables
+const baseMessagePrefix = "Base"
+
+//field names taken as identifiers of table, compared in lower case
+var identifierNames = []string{"id", "uid", "uuid", "guid", "key", "token"}
+
+//base table suggested by scanning source proto files
+type baseSuggestion struct {
+	name string
+	file string
+	//suggested primary keys, empty if message is skipped
+	keys []string
+	//why the message is suggested or skipped
+	reason string
+}
+
+//scan parsed source proto files, find messages named Base* which are not list, blob, split or pub messages, and their likely key fields
+//messages with table annotation are skipped, as they are classified by annotation without base_tables config
+func suggestBaseTables() []baseSuggestion {
+	var files []string
+	for file := range protoInfos {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var suggestions []baseSuggestion
+	for _, file := range files {
+		for _, msg := range protoInfos[file].msgs {
+			if !strings.HasPrefix(msg.Name, baseMessagePrefix) {
+				continue
+			}
+			suggestion := baseSuggestion{name: msg.Name, file: file}
+			if _, ok := tableAnnotation(msg); ok {
+				suggestion.reason = fmt.Sprintf("skipped, classified by %s annotation", comm.TableAnnotation)
+			} else if class := classifyByNamingRules(msg); class.kind != "COMM" {
+				suggestion.reason = fmt.Sprintf("skipped, classified as %s by %s", kindString(class), class.rule)
+			} else if key, reason := suggestKeyField(msg); key == "" {
+				suggestion.reason = "skipped, no field can be primary key, types of key field: " + strings.Join(comm.TcaplusLimits.KeyFieldTypes, ", ")
+			} else {
+				suggestion.keys = []string{key}
+				suggestion.reason = fmt.Sprintf("suggested, primary key %s: %s", key, reason)
+			}
+			suggestions = append(suggestions, suggestion)
+		}
+	}
+	return suggestions
+}
+
+//find likely key field of base message, the reason of choice is returned, empty key returned if no field can be primary key
+//fields named after the table are taken first, such as `version` of BaseVersion or `roleID` of BaseRoles
+//then identifier fields such as `id`, `uid`, `token`, or field names ending with ID, at last the first field of key type
+func suggestKeyField(msg comm.Message) (string, string) {
+	stem := normalizeName(strings.TrimSuffix(strings.TrimPrefix(msg.Name, baseMessagePrefix), "s"))
+	var identifier, first string
+	for _, field := range msg.Fields {
+		if field.IsRepeated || isEntityMarker(field) || !containsString(comm.TcaplusLimits.KeyFieldTypes, field.Type) {
+			continue
+		}
+		name := normalizeName(field.Name)
+		if stem != "" && (name == stem || name == stem+"id") {
+			return field.Name, "named after the table"
+		}
+		if identifier == "" && (containsString(identifierNames, name) || strings.HasSuffix(field.Name, "ID") ||
+			strings.HasSuffix(field.Name, "Id") || strings.HasSuffix(field.Name, "_id")) {
+			identifier = field.Name
+		}
+		if first == "" {
+			first = field.Name
+		}
+	}
+	if identifier != "" {
+		return identifier, "named as identifier"
+	}
+	if first != "" {
+		return first, fmt.Sprintf("as the first field of %s type", keyTypeOf(msg, first))
+	}
+	return "", ""
+}
+
+//lower case name without underscores, so that `role_id` and `roleID` are the same
+func normalizeName(name string) string {
+	return strings.ToLower(strings.Replace(name, "_", "", -1))
+}
+
+func keyTypeOf(msg comm.Message, name string) string {
+	for _, field := range msg.Fields {
+		if field.Name == name {
+			return field.Type
+		}
+	}
+	return ""
+}
+
+//get blob categories having blob messages in parsed source proto files, and the categories without blob messages
+func usedBlobCategories() ([]string, []string) {
+	used := map[string]bool{}
+	for _, info := range protoInfos {
+		for _, msg := range info.msgs {
+			if class := classifyMessage(msg); class.kind == "BLOB" {
+				used[class.blobType] = true
+			}
+		}
+	}
+	var names, removed []string
+	for _, cat := range comm.BlobCategories {
+		if used[cat.Name] {
+			names = append(names, cat.Name)
+		} else {
+			removed = append(removed, cat.Name)
+		}
+	}
+	return names, removed
+}
+
+//output suggestions of base tables and how they are chosen
+func outputSuggestions(srcPath string, suggestions []baseSuggestion) {
+	fmt.Printf("Scanned %s for base tables, messages named %s* which are not list, blob, split or pub messages:\n", srcPath, baseMessagePrefix)
+	if len(suggestions) == 0 {
+		fmt.Println("  no candidate found, base_tables is left empty")
+	}
+	for _, s := range suggestions {
+		fmt.Printf("  %s (%s): %s\n", s.name, s.file, s.reason)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestInitThenConvert(t *testing.T) {
+	//sources without SOCIAL_ blob messages
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, os.Remove(filepath.Join(src, "social.proto")))
+
+	resetParseState()
+	config, err := scaffoldConfig(src)
+	assert.NoError(t, err)
+	assert.Contains(t, config, "    blob_proto_files = \"IN:blob_user_data_in.proto, OUT:blob_user_data_out.proto\"\n")
+	assert.NotContains(t, config, "SOCIAL")
+	cfg := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(cfg, []byte(config), 0644))
+
+	assert.NoError(t, convertWithConfig(t, cfg, src, dst))
+	assert.Equal(t, map[string]string{}, errorInfos)
+	assert.Equal(t, exitOK, resultCode())
+	assert.Equal(t, []string{"BaseAccounts", "BaseVersion"}, comm.BaseTables)
+	assert.FileExists(t, filepath.Join(dst, "blob_user_data_in.proto"))
+	_, err = os.Stat(filepath.Join(dst, "blob_user_data_social.proto"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"github.com/tencentyun/proto-parse-tcaplus/tools"
+)
+
+//generated table of a schema, a schema is a set of generated tcaplusdb tables
+type schemaTable struct {
+	//proto file of table
+	file string
+	msg  comm.Message
+}
+
+//kinds of schema change
+const (
+	tableAdded   string = "table_added"
+	tableRemoved string = "table_removed"
+	tableMoved   string = "table_moved"
+	optionChange string = "option_changed"
+	fieldAdded   string = "field_added"
+	fieldRemoved string = "field_removed"
+	fieldChange  string = "field_changed"
+)
+
+//change of table between two schemas
+type schemaChange struct {
+	//change kind, such as table_added, field_removed
+	kind  string
+	table string
+	//field name, empty for table level change
+	field  string
+	detail string
+	//breaking change is not allowed by tcaplusdb online schema change, or makes existing data unreadable
+	breaking bool
+}
+
+func (c schemaChange) String() string {
+	level := "COMPATIBLE"
+	if c.breaking {
+		level = "BREAKING"
+	}
+	location := c.table
+	if c.field != "" {
+		location = fmt.Sprintf("%s.%s", c.table, c.field)
+	}
+	return fmt.Sprintf("[%s] [%s] %s", level, location, c.detail)
+}
+
+//load schema from generated proto files, message with primary key option is a table
+func loadSchema(dir string) (map[string]schemaTable, error) {
+	protoFiles, err := tools.GetProtoFiles(dir, "")
+	if err != nil {
+		return nil, fmt.Errorf("get proto files error : %v", err)
+	}
+	schema := map[string]schemaTable{}
+	for _, file := range protoFiles {
+		//parse proto file into protoInfo (global variable), and reset it
+		if err := parse(file); err != nil {
+			protoInfo = ProtoInfo{}
+			return nil, err
+		}
+		msgs := protoInfo.msgs
+		protoInfo = ProtoInfo{}
+		for _, msg := range msgs {
+			if messageOption(msg, primaryKeyOption) == "" {
+				continue
+			}
+			if s, ok := schema[msg.Name]; ok {
+				return nil, fmt.Errorf("table %s is defined in both %s and %s", msg.Name, s.file, path.Base(file))
+			}
+			schema[msg.Name] = schemaTable{file: path.Base(file), msg: msg}
+		}
+	}
+	return schema, nil
+}
+
+//get schema of tables built by current run
+func builtSchema() map[string]schemaTable {
+	schema := map[string]schemaTable{}
+	for file, ts := range tables {
+		for _, t := range ts {
+			schema[t.msg.Name] = schemaTable{file: file, msg: t.msg}
+		}
+	}
+	return schema
+}
+
+//get option value of message, empty string returned if option not exist
+func messageOption(msg comm.Message, name string) string {
+	for _, opt := range msg.Options {
+		if opt.Name == name {
+			return opt.Value
+		}
+	}
+	return ""
+}
+
+//diff two schemas, changes are sorted by table name
+func diffSchemas(oldSchema map[string]schemaTable, newSchema map[string]schemaTable) []schemaChange {
+	names := map[string]bool{}
+	for name := range oldSchema {
+		names[name] = true
+	}
+	for name := range newSchema {
+		names[name] = true
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var changes []schemaChange
+	for _, name := range sorted {
+		oldTable, inOld := oldSchema[name]
+		newTable, inNew := newSchema[name]
+		switch {
+		case !inOld:
+			changes = append(changes, schemaChange{kind: tableAdded, table: name, detail: fmt.Sprintf("table added in %s", newTable.file)})
+		case !inNew:
+			changes = append(changes, schemaChange{kind: tableRemoved, table: name, detail: fmt.Sprintf("table removed from %s", oldTable.file), breaking: true})
+		default:
+			if oldTable.file != newTable.file {
+				changes = append(changes, schemaChange{kind: tableMoved, table: name, detail: fmt.Sprintf("table moved from %s to %s", oldTable.file, newTable.file)})
+			}
+			changes = append(changes, diffTable(name, oldTable.msg, newTable.msg)...)
+		}
+	}
+	return changes
+}
+
+//tcaplusdb table options compared by diff, the table can not be altered online if any of them changes
+var keyOptions = []struct {
+	name  string
+	title string
+}{
+	{primaryKeyOption, "primary key"},
+	{indexOption, "index"},
+	{shardingKeyOption, "sharding key"},
+	{customAttrOption, "custom attribute"},
+}
+
+//diff two versions of a table
+//adding a field is compatible, removing a field is compatible only if its number is reserved
+//changing the type, number or label of a field, or the key options of table is breaking
+func diffTable(name string, oldMsg comm.Message, newMsg comm.Message) []schemaChange {
+	var changes []schemaChange
+	for _, opt := range keyOptions {
+		oldValue := messageOption(oldMsg, opt.name)
+		newValue := messageOption(newMsg, opt.name)
+		if oldValue != newValue {
+			changes = append(changes, schemaChange{kind: optionChange, table: name, detail: fmt.Sprintf("%s changed from %q to %q", opt.title, oldValue, newValue), breaking: true})
+		}
+	}
+	newFields := map[string]comm.Field{}
+	newIds := map[int]string{}
+	for _, field := range newMsg.Fields {
+		newFields[field.Name] = field
+		newIds[field.ID] = field.Name
+	}
+	oldFields := map[string]bool{}
+	for _, oldField := range oldMsg.Fields {
+		oldFields[oldField.Name] = true
+		newField, ok := newFields[oldField.Name]
+		if !ok {
+			if newName, ok := newIds[oldField.ID]; ok {
+				changes = append(changes, schemaChange{kind: fieldChange, table: name, field: oldField.Name,
+					detail: fmt.Sprintf("field number %d renamed from %s to %s", oldField.ID, oldField.Name, newName), breaking: true})
+			} else if containsInt(newMsg.ReservedIDs, oldField.ID) {
+				changes = append(changes, schemaChange{kind: fieldRemoved, table: name, field: oldField.Name,
+					detail: fmt.Sprintf("field removed, number %d is reserved", oldField.ID)})
+			} else {
+				changes = append(changes, schemaChange{kind: fieldRemoved, table: name, field: oldField.Name,
+					detail: fmt.Sprintf("field removed, number %d is not reserved", oldField.ID), breaking: true})
+			}
+			continue
+		}
+		if oldField.ID != newField.ID {
+			changes = append(changes, schemaChange{kind: fieldChange, table: name, field: oldField.Name,
+				detail: fmt.Sprintf("field number changed from %d to %d", oldField.ID, newField.ID), breaking: true})
+		}
+		if oldField.Type != newField.Type {
+			changes = append(changes, schemaChange{kind: fieldChange, table: name, field: oldField.Name,
+				detail: fmt.Sprintf("field type changed from %s to %s", oldField.Type, newField.Type), breaking: true})
+		}
+		if oldField.IsRepeated != newField.IsRepeated {
+			changes = append(changes, schemaChange{kind: fieldChange, table: name, field: oldField.Name,
+				detail: fmt.Sprintf("field label changed from %s to %s", fieldLabel(oldField), fieldLabel(newField)), breaking: true})
+		}
+	}
+	oldIds := map[int]bool{}
+	for _, field := range oldMsg.Fields {
+		oldIds[field.ID] = true
+	}
+	for _, newField := range newMsg.Fields {
+		if oldFields[newField.Name] || oldIds[newField.ID] {
+			//renamed field is reported with old field
+			continue
+		}
+		change := schemaChange{kind: fieldAdded, table: name, field: newField.Name, detail: fmt.Sprintf("field added, number %d, type %s", newField.ID, newField.Type)}
+		if containsInt(oldMsg.ReservedIDs, newField.ID) {
+			change.detail = fmt.Sprintf("field added, number %d is reserved before", newField.ID)
+			change.breaking = true
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func fieldLabel(field comm.Field) string {
+	if field.IsRepeated {
+		return "repeated"
+	}
+	return "singular"
+}
+
+func containsInt(items []int, item int) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+//diff generated proto files of two directories, and output the changes
+//the number of breaking changes is returned
+func DiffSchemaDirs(oldDir string, newDir string) (int, error) {
+	oldSchema, err := loadSchema(oldDir)
+	if err != nil {
+		return 0, fmt.Errorf("load %s error: %v", oldDir, err)
+	}
+	newSchema, err := loadSchema(newDir)
+	if err != nil {
+		return 0, fmt.Errorf("load %s error: %v", newDir, err)
+	}
+	return outputSchemaChanges(diffSchemas(oldSchema, newSchema)), nil
+}
+
+//load generated proto files of baseline directory
+//it must be loaded before generated files are written, as the destination path is usually the baseline
+func loadBaseline(baseline string) (map[string]schemaTable, error) {
+	baseSchema, err := loadSchema(baseline)
+	if err != nil {
+		return nil, fmt.Errorf("load baseline %s error: %v", baseline, err)
+	}
+	return baseSchema, nil
+}
+
+//compare tables built by current run with schema of baseline directory, and output the changes
+//the number of breaking changes is returned
+func CheckBaseline(baseline string, baseSchema map[string]schemaTable) int {
+	fmt.Printf("Compare with baseline: %s\n", baseline)
+	return outputSchemaChanges(diffSchemas(baseSchema, builtSchema()))
+}
+
+//output schema changes and summary, the number of breaking changes is returned
+func outputSchemaChanges(changes []schemaChange) int {
+	breaking := 0
+	for _, c := range changes {
+		fmt.Println(c)
+		if c.breaking {
+			breaking = breaking + 1
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Println("no schema changes")
+	} else {
+		fmt.Printf("%d schema changes, %d breaking\n", len(changes), breaking)
+	}
+	return breaking
+}
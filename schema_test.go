@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestDiffTable(t *testing.T) {
+	key := comm.Option{Name: primaryKeyOption, Value: "UID"}
+	old := comm.Message{Name: "T", Options: []comm.Option{key}, Fields: []comm.Field{
+		{ID: 1, Name: "UID", Type: "uint64"},
+		{ID: 2, Name: "Level", Type: "uint32"},
+		{ID: 3, Name: "Items", Type: "bytes"},
+	}}
+	cases := []struct {
+		name string
+		edit func(oldMsg *comm.Message, msg *comm.Message)
+		//kinds of changes, and whether each is breaking
+		kinds    []string
+		breaking []bool
+	}{
+		{"no change", func(oldMsg *comm.Message, msg *comm.Message) {}, nil, nil},
+		{"field added", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields = append(msg.Fields, comm.Field{ID: 4, Name: "Exp", Type: "uint32"})
+		}, []string{fieldAdded}, []bool{false}},
+		{"field added with reserved number", func(oldMsg *comm.Message, msg *comm.Message) {
+			oldMsg.ReservedIDs = []int{4}
+			msg.Fields = append(msg.Fields, comm.Field{ID: 4, Name: "Exp", Type: "uint32"})
+		}, []string{fieldAdded}, []bool{true}},
+		{"removed field reserved", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields = msg.Fields[:2]
+			msg.ReservedIDs = []int{3}
+		}, []string{fieldRemoved}, []bool{false}},
+		{"removed field not reserved", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields = msg.Fields[:2]
+		}, []string{fieldRemoved}, []bool{true}},
+		{"field renamed", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields[1].Name = "Lv"
+		}, []string{fieldChange}, []bool{true}},
+		{"number changed", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields[1].ID = 5
+		}, []string{fieldChange}, []bool{true}},
+		{"type changed", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields[1].Type = "uint64"
+		}, []string{fieldChange}, []bool{true}},
+		{"label changed", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Fields[2].IsRepeated = true
+		}, []string{fieldChange}, []bool{true}},
+		{"primary key changed", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Options = []comm.Option{{Name: primaryKeyOption, Value: "UID,Level"}}
+		}, []string{optionChange}, []bool{true}},
+		{"index added", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Options = append(msg.Options, comm.Option{Name: indexOption, Value: "index_1(UID)"})
+		}, []string{optionChange}, []bool{true}},
+		{"sharding key added", func(oldMsg *comm.Message, msg *comm.Message) {
+			msg.Options = append(msg.Options, comm.Option{Name: shardingKeyOption, Value: "UID"})
+		}, []string{optionChange}, []bool{true}},
+	}
+	for _, c := range cases {
+		oldMsg, newMsg := old, old
+		newMsg.Options = append([]comm.Option{}, old.Options...)
+		newMsg.Fields = append([]comm.Field{}, old.Fields...)
+		c.edit(&oldMsg, &newMsg)
+		var kinds []string
+		var breaking []bool
+		for _, change := range diffTable("T", oldMsg, newMsg) {
+			kinds = append(kinds, change.kind)
+			breaking = append(breaking, change.breaking)
+		}
+		assert.Equal(t, c.kinds, kinds, c.name)
+		assert.Equal(t, c.breaking, breaking, c.name)
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	msg := comm.Message{Name: "T", Fields: []comm.Field{{ID: 1, Name: "UID", Type: "uint64"}}}
+	oldSchema := map[string]schemaTable{"A": {file: "a.proto", msg: msg}, "B": {file: "a.proto", msg: msg}}
+	newSchema := map[string]schemaTable{"B": {file: "b.proto", msg: msg}, "C": {file: "b.proto", msg: msg}}
+	var changes []string
+	for _, change := range diffSchemas(oldSchema, newSchema) {
+		changes = append(changes, change.String())
+	}
+	assert.Equal(t, []string{
+		"[BREAKING] [A] table removed from a.proto",
+		"[COMPATIBLE] [B] table moved from a.proto to b.proto",
+		"[COMPATIBLE] [C] table added in b.proto",
+	}, changes)
+}
+
+func TestConvertWithBaseline(t *testing.T) {
+	//destination path keeps the lock between runs, like committed outputs checked by ci
+	src, baseline, dst := copyTestdata(t), t.TempDir(), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, baseline))
+	assert.NoError(t, convertForTest(t, src, dst))
+	cfgFile, protoSrcPath, protoDstPath = "config/proto_parse.cfg", src, dst
+	defer func() { protoSrcPath, protoDstPath = "", "" }()
+
+	//removed field is reserved, which is compatible
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		return regexp.MustCompile(`(?m)^.*mailLevel.*\n`).ReplaceAllString(s, "")
+	})
+	code, err := convertOnce(baseline, false)
+	assert.NoError(t, err)
+	assert.Equal(t, exitOK, code)
+
+	//type change is breaking, which fails unless allowed
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		return regexp.MustCompile(`uint32 exp = 5;`).ReplaceAllString(s, "uint64 exp = 5;")
+	})
+	for _, c := range []struct {
+		allowBreaking bool
+		code          int
+	}{{false, exitFailed}, {true, exitOK}} {
+		code, err := convertOnce(baseline, c.allowBreaking)
+		assert.NoError(t, err)
+		assert.Equal(t, c.code, code, "allow breaking: %v", c.allowBreaking)
+	}
+}
+
+func TestConvertWithBaselineInDestPath(t *testing.T) {
+	//generated files in destination path are the baseline, they are compared before overwritten
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, convertForTest(t, src, dst))
+	cfgFile, protoSrcPath, protoDstPath = "config/proto_parse.cfg", src, dst
+	defer func() { protoSrcPath, protoDstPath = "", "" }()
+	code, err := convertOnce(dst, false)
+	assert.NoError(t, err)
+	assert.Equal(t, exitOK, code)
+
+	editFile(t, filepath.Join(src, "battlePass.proto"), func(s string) string {
+		return regexp.MustCompile(`uint32 exp = 5;`).ReplaceAllString(s, "uint64 exp = 5;")
+	})
+	code, err = convertOnce(dst, false)
+	assert.NoError(t, err)
+	assert.Equal(t, exitFailed, code)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"github.com/tencentyun/proto-parse-tcaplus/tools"
+)
+
+//tcaplusdb options of generated table
+const (
+	primaryKeyOption  string = "(tcaplusservice.tcaplus_primary_key)"
+	indexOption       string = "(tcaplusservice.tcaplus_index)"
+	customAttrOption  string = "(tcaplusservice.tcaplus_customattr)"
+	shardingKeyOption string = "(tcaplusservice.tcaplus_sharding_key)"
+)
+
+//source of injected column in fieldSources
+const injectedSource string = "injected column"
+
+//generated tcaplusdb table
+type table struct {
+	//generated table message, options are tcaplusdb options such as primary key
+	msg comm.Message
+	//table name before naming policy applied, used to look up config of table
+	name string
+	//table category: BASE, SPLIT, PUB, LIST, BLOB
+	category string
+	//source message name, source messages of blob table are saved in fieldSources
+	source string
+	//source of each generated field, key: generated field name, value: source message and field, such as OUT_Pet.id
+	fieldSources map[string]string
+	//fields named the same as former fields, key: generated field name, value: source of the latter field
+	collisions map[string]string
+}
+
+//create table, the table name is converted by table name mapping and naming policy
+func newTable(name string, category string, source string) table {
+	return table{
+		msg:          comm.Message{Name: tableName(name)},
+		name:         name,
+		category:     category,
+		source:       source,
+		fieldSources: map[string]string{},
+		collisions:   map[string]string{},
+	}
+}
+
+//convert name of table, field or injected column by naming policy
+func policyName(name string) string {
+	return tools.ConvertName(name, comm.NamingPolicy, comm.NamingAcronyms)
+}
+
+//get generated table name of source message or blob table
+//explicit rename is used as it is, otherwise the prefix is stripped, regex rewrites are applied in order, and then naming policy except title
+func tableName(name string) string {
+	if rename, ok := comm.TableNameRenames[name]; ok {
+		return rename
+	}
+	if prefix, ok := matchPrefix(name, comm.TableNameStripPrefixes); ok {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	for _, rewrite := range comm.TableNameRewrites {
+		name = rewrite.Pattern.ReplaceAllString(name, rewrite.Replacement)
+	}
+	//title policy is the default, it keeps table names as they are, only field names are titled
+	if comm.NamingPolicy == tools.NamingTitle {
+		return name
+	}
+	return policyName(name)
+}
+
+func (t *table) addOption(name string, value string) {
+	t.msg.Options = append(t.msg.Options, comm.Option{Name: name, Value: value})
+}
+
+func (t *table) addField(field comm.Field, source string) {
+	t.msg.Fields = append(t.msg.Fields, field)
+	if _, ok := t.fieldSources[field.Name]; ok {
+		t.collisions[field.Name] = source
+		return
+	}
+	t.fieldSources[field.Name] = source
+}
+
+//get option value of table, empty string returned if option not exist
+func (t *table) option(name string) string {
+	return messageOption(t.msg, name)
+}
+
+//add injected columns with sequence id starting from seqId, return the last sequence id added
+func (t *table) addColumns(columns []comm.Column, seqId int) int {
+	for _, col := range columns {
+		t.addField(comm.Field{ID: seqId, Name: policyName(col.Name), Type: col.Type}, injectedSource)
+		seqId = seqId + 1
+	}
+	return seqId - 1
+}
+
+//get generated field name of source field, the name converted by naming policy is returned if no generated field for it
+//such as injected column
+func (t *table) generatedName(sourceField string) string {
+	source := fmt.Sprintf("%s.%s", t.source, sourceField)
+	for name, s := range t.fieldSources {
+		if s == source {
+			return name
+		}
+	}
+	return policyName(sourceField)
+}
+
+//write generated table into bytes.Buffer
+func writeTable(t table) {
+	if t.category == "BLOB" {
+		buf.WriteString(fmt.Sprintf("message %v { \n", t.msg.Name))
+	} else {
+		buf.WriteString(fmt.Sprintf("message %s{\n", t.msg.Name))
+	}
+	for _, opt := range t.msg.Options {
+		buf.WriteString(fmt.Sprintf("\toption%s = \"%s\";\n", opt.Name, opt.Value))
+	}
+	if len(t.msg.ReservedIDs) > 0 {
+		var ids []string
+		for _, id := range t.msg.ReservedIDs {
+			ids = append(ids, strconv.Itoa(id))
+		}
+		buf.WriteString(fmt.Sprintf("\treserved %s;\n", strings.Join(ids, ", ")))
+	}
+	if len(t.msg.ReservedNames) > 0 {
+		buf.WriteString(fmt.Sprintf("\treserved \"%s\";\n", strings.Join(t.msg.ReservedNames, "\", \"")))
+	}
+	for _, field := range t.msg.Fields {
+		fieldStr := ""
+		if field.IsRepeated {
+			fieldStr = "repeated "
+		}
+		buf.WriteString(fmt.Sprintf("\t%v%v %v = %v;\n", fieldStr, field.Type, field.Name, field.ID))
+	}
+	for _, enumf := range t.msg.Enums {
+		//deal nested enums
+		writeEnum(enumf)
+	}
+	buf.WriteString("}\n")
+}
@@ -3,6 +3,8 @@ package tools
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/tencentyun/proto-parse-tcaplus/comm"
@@ -34,10 +36,8 @@ func ParseCfg(cfg *ini.File) error {
 		return err
 	}
 
-	//init map object to avoid invalid address error
-	comm.BaseTableMap = make(map[string]string)
-	comm.BlobFiles = make(map[string]string)
-	comm.TableFiles = make(map[string]string)
+	//reset all items to default values, so that config file can be parsed again
+	comm.ResetConfig()
 
 	if ok := busSec.HasKey("base_tables"); ok {
 		//parse base tables
@@ -102,28 +102,61 @@ func ParseCfg(cfg *ini.File) error {
 	}
 
 	if ok := busSec.HasKey("blob_proto_files"); ok {
-		//parse config , get blob proto files
-		blobProtoFiles := strings.Split(busSec.Key("blob_proto_files").Value(), ",")
-		for i := range blobProtoFiles {
-			blobProtoFiles[i] = strings.TrimSpace(blobProtoFiles[i])
-			infos := strings.Split(blobProtoFiles[i], ":")
-			for j := range infos {
-				infos[j] = strings.TrimSpace(infos[j])
-			}
-			blobType := infos[0]
-			if blobType == "" {
-				continue
-			}
-
-			if len(infos) > 0 {
-				filename := infos[1]
-				comm.BlobFiles[blobType] = filename
-			} else if val, ok := comm.GlobalBlobFiles[blobType]; ok {
-				comm.BlobFiles[blobType] = val
+		//parse config , get blob categories
+		categories, err := parseBlobCategories(busSec.Key("blob_proto_files").Value())
+		if err != nil {
+			return fmt.Errorf("blob_proto_files error: %v", err)
+		}
+		comm.BlobCategories = categories
+	} else {
+		comm.BlobCategories = append([]comm.BlobCategory{}, comm.GlobalBlobCategories...)
+	}
+	if ok := busSec.HasKey("sharding_keys"); ok {
+		//parse config, get sharding key of each table category
+		keys, err := parseMapItem(busSec.Key("sharding_keys").Value())
+		if err != nil {
+			return fmt.Errorf("sharding_keys error: %v", err)
+		}
+		for category := range keys {
+			if !containsItem(TableCategories, category) {
+				return fmt.Errorf("sharding_keys error: unknown table category %s, should be one of %s", category, strings.Join(TableCategories, ", "))
 			}
 		}
+		comm.ShardingKeys = keys
 	} else {
-		comm.BlobFiles = comm.GlobalBlobFiles
+		comm.ShardingKeys = comm.GlobalShardingKeys
+	}
+	if ok := busSec.HasKey("table_sharding_keys"); ok {
+		//parse config, get sharding key of specified tables
+		keys, err := parseMapItem(busSec.Key("table_sharding_keys").Value())
+		if err != nil {
+			return fmt.Errorf("table_sharding_keys error: %v", err)
+		}
+		comm.TableShardingKeys = keys
+	}
+	if ok := busSec.HasKey("list_message_prefix"); ok {
+		comm.ListMessagePrefix = strings.TrimSpace(busSec.Key("list_message_prefix").Value())
+	}
+	if ok := busSec.HasKey("list_max_num"); ok {
+		num, err := busSec.Key("list_max_num").Int()
+		if err != nil {
+			return fmt.Errorf("list_max_num error: %v", err)
+		}
+		comm.ListMaxNum = num
+	}
+	if ok := busSec.HasKey("list_table_max_nums"); ok {
+		//parse config, get max element num of specified list tables
+		nums, err := parseMapItem(busSec.Key("list_table_max_nums").Value())
+		if err != nil {
+			return fmt.Errorf("list_table_max_nums error: %v", err)
+		}
+		for tableName, val := range nums {
+			num, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("list_table_max_nums error: %s %v", tableName, err)
+			}
+			comm.ListTableMaxNums[tableName] = num
+		}
 	}
 	if ok := busSec.HasKey("blob_user_in_msg_name"); ok {
 
@@ -139,6 +172,97 @@ func ParseCfg(cfg *ini.File) error {
 			comm.BlobUserOutMsg = name
 		}
 	}
+	for i := range comm.BlobCategories {
+		//assign default blob table name, and build blob proto files map
+		cat := &comm.BlobCategories[i]
+		if cat.Table == "" {
+			switch cat.Name {
+			case "IN":
+				cat.Table = comm.BlobUserInMsg
+			case "OUT":
+				cat.Table = comm.BlobUserOutMsg
+			default:
+				cat.Table = "BlobUserData" + UpperFirst(strings.ToLower(cat.Name))
+			}
+		}
+		comm.BlobFiles[cat.Name] = cat.File
+	}
+	if ok := busSec.HasKey("blob_max_columns"); ok {
+		//parse config, get max column num of blob categories
+		if err := parseBlobLimits(busSec.Key("blob_max_columns").Value(), func(cat *comm.BlobCategory, num int) {
+			cat.MaxColumns = num
+		}); err != nil {
+			return fmt.Errorf("blob_max_columns error: %v", err)
+		}
+	}
+	if ok := busSec.HasKey("blob_max_sizes"); ok {
+		//parse config, get max estimated record size of blob categories
+		if err := parseBlobLimits(busSec.Key("blob_max_sizes").Value(), func(cat *comm.BlobCategory, num int) {
+			cat.MaxSize = num
+		}); err != nil {
+			return fmt.Errorf("blob_max_sizes error: %v", err)
+		}
+	}
+	if ok := busSec.HasKey("split_message_prefixes"); ok {
+		comm.SplitMessagePrefixes = splitItems(busSec.Key("split_message_prefixes").Value())
+	} else {
+		comm.SplitMessagePrefixes = comm.GlobalSplitMessagePrefixes
+	}
+	if ok := busSec.HasKey("pub_message_prefixes"); ok {
+		comm.PubMessagePrefixes = splitItems(busSec.Key("pub_message_prefixes").Value())
+	} else {
+		comm.PubMessagePrefixes = comm.GlobalPubMessagePrefixes
+	}
+	if ok := busSec.HasKey("entity_marker_type"); ok {
+		marker := strings.TrimSpace(busSec.Key("entity_marker_type").Value())
+		if marker == "" {
+			return fmt.Errorf("entity_marker_type error: empty marker type")
+		}
+		comm.EntityMarkerType = marker
+	}
+	if ok := busSec.HasKey("entity_key_names"); ok {
+		names := splitItems(busSec.Key("entity_key_names").Value())
+		if len(names) == 0 {
+			return fmt.Errorf("entity_key_names error: no key name")
+		}
+		comm.EntityKeyNames = names
+	} else {
+		comm.EntityKeyNames = comm.GlobalEntityKeyNames
+	}
+	if ok := busSec.HasKey("entity_key_types"); ok {
+		comm.EntityKeyTypes = splitItems(busSec.Key("entity_key_types").Value())
+	} else {
+		comm.EntityKeyTypes = comm.GlobalEntityKeyTypes
+	}
+	if ok := busSec.HasKey("preserve_field_numbers"); ok {
+		categories := splitItems(busSec.Key("preserve_field_numbers").Value())
+		for _, category := range categories {
+			if category != "BASE" && category != "LIST" {
+				return fmt.Errorf("preserve_field_numbers error: unsupported table category %s, should be BASE or LIST", category)
+			}
+		}
+		comm.PreserveFieldNumbers = categories
+	} else {
+		comm.PreserveFieldNumbers = []string{}
+	}
+	if ok := busSec.HasKey("naming_policy"); ok {
+		policy := strings.TrimSpace(busSec.Key("naming_policy").Value())
+		if !containsItem(NamingPolicies, policy) {
+			return fmt.Errorf("naming_policy error: unknown policy %q, should be one of %s", policy, strings.Join(NamingPolicies, ", "))
+		}
+		comm.NamingPolicy = policy
+	}
+	if ok := busSec.HasKey("naming_acronyms"); ok {
+		comm.NamingAcronyms = splitItems(busSec.Key("naming_acronyms").Value())
+	} else {
+		comm.NamingAcronyms = comm.GlobalNamingAcronyms
+	}
+	if ok := busSec.HasKey("lock_file"); ok {
+		name := strings.TrimSpace(busSec.Key("lock_file").Value())
+		if name != "" {
+			comm.LockFile = name
+		}
+	}
 	if ok := busSec.HasKey("proto_file_ignores"); ok {
 		ignores := strings.TrimSpace(busSec.Key("proto_file_ignores").Value())
 		if ignores != "" {
@@ -162,6 +286,40 @@ func ParseCfg(cfg *ini.File) error {
 		comm.IgnoreImportPaths = append(comm.IgnoreImportPaths, comm.GlobalIgnoreImportPaths[:]...)
 	}
 
+	if colSec, err := cfg.GetSection("injected_columns"); err == nil {
+		//parse injected columns of table categories and tables, the section replaces default injected columns
+		comm.InjectedColumns = make(map[string][]comm.Column)
+		for _, key := range colSec.Keys() {
+			columns, err := parseColumns(key.Value())
+			if err != nil {
+				return fmt.Errorf("injected_columns %s error: %v", key.Name(), err)
+			}
+			comm.InjectedColumns[key.Name()] = columns
+		}
+	} else {
+		comm.InjectedColumns = comm.GlobalInjectedColumns
+	}
+
+	if nameSec, err := cfg.GetSection("table_names"); err == nil {
+		//parse table name mapping
+		if err := parseTableNames(nameSec); err != nil {
+			return err
+		}
+	} else {
+		comm.TableNameStripPrefixes = []string{}
+		comm.TableNameRewrites = []comm.NameRewrite{}
+		comm.TableNameRenames = map[string]string{}
+	}
+
+	if limitSec, err := cfg.GetSection("limits"); err == nil {
+		//parse limits profile of tcaplusdb engine, the item not specified is assigned by default
+		if err := parseLimits(limitSec); err != nil {
+			return err
+		}
+	} else {
+		comm.TcaplusLimits = comm.GlobalLimits
+	}
+
 	tcaplusSec, err := cfg.GetSection("tcaplusdb")
 	if err != nil {
 		fmt.Println(err)
@@ -182,3 +340,253 @@ func ParseCfg(cfg *ini.File) error {
 	return nil
 
 }
+
+//table categories of sharding_keys
+var TableCategories = []string{"BASE", "PUB", "SPLIT", "LIST", "BLOB"}
+
+//parse config item like "KEY1:value1, KEY2:value2", comma separates each item, `:` separates key and value
+//empty items are ignored, item without key is an error
+func parseMapItem(value string) (map[string]string, error) {
+	items := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		infos := strings.SplitN(item, ":", 2)
+		if len(infos) < 2 || strings.TrimSpace(infos[0]) == "" {
+			return nil, fmt.Errorf("illegal item %q, should be key:value", item)
+		}
+		items[strings.TrimSpace(infos[0])] = strings.TrimSpace(infos[1])
+	}
+	return items, nil
+}
+
+//parse injected columns like "UID:uint64:head:key, UpdateTime:uint64:tail", comma separates each column
+//`:` separates column name, type, position (head or tail) and optional key flag
+func parseColumns(value string) ([]comm.Column, error) {
+	var columns []comm.Column
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		infos := strings.Split(item, ":")
+		for j := range infos {
+			infos[j] = strings.TrimSpace(infos[j])
+		}
+		if len(infos) < 3 || len(infos) > 4 {
+			return nil, fmt.Errorf("illegal column %q", item)
+		}
+		col := comm.Column{
+			Name:     infos[0],
+			Type:     infos[1],
+			Position: infos[2],
+		}
+		if col.Name == "" {
+			return nil, fmt.Errorf("illegal column %q, empty name", item)
+		}
+		if !isScalarType(col.Type) {
+			return nil, fmt.Errorf("illegal column %q, unknown type %s", item, col.Type)
+		}
+		if col.Position != "head" && col.Position != "tail" {
+			return nil, fmt.Errorf("illegal column %q, position must be head or tail", item)
+		}
+		if len(infos) == 4 {
+			if infos[3] != "key" {
+				return nil, fmt.Errorf("illegal column %q, unknown flag %s", item, infos[3])
+			}
+			col.IsKey = true
+		}
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+func isScalarType(name string) bool {
+	for _, dtype := range comm.ProtoDataTypes {
+		if name == dtype {
+			return true
+		}
+	}
+	return false
+}
+
+func containsItem(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+//parse limits profile of tcaplusdb engine
+func parseLimits(sec *ini.Section) error {
+	limits := comm.GlobalLimits
+	intItems := map[string]*int{
+		"max_key_fields": &limits.MaxKeyFields,
+		"max_index_num":  &limits.MaxIndexNum,
+		"max_fields":     &limits.MaxFields,
+		"max_list_num":   &limits.MaxListNum,
+	}
+	for name, val := range intItems {
+		if ok := sec.HasKey(name); ok {
+			num, err := sec.Key(name).Int()
+			if err != nil {
+				return fmt.Errorf("limits %s error: %v", name, err)
+			}
+			*val = num
+		}
+	}
+	if ok := sec.HasKey("key_field_types"); ok {
+		limits.KeyFieldTypes = splitItems(sec.Key("key_field_types").Value())
+	}
+	if ok := sec.HasKey("reserved_field_names"); ok {
+		limits.ReservedFieldNames = splitItems(sec.Key("reserved_field_names").Value())
+	}
+	comm.TcaplusLimits = limits
+	return nil
+}
+
+//split comma separated items, trim spaces and ignore empty items
+func splitItems(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+//split comma separated items like splitItems, but `\,` is a comma in item instead of a separator
+func splitEscapedItems(value string) []string {
+	items := []string{}
+	var item strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(item.String()); s != "" {
+			items = append(items, s)
+		}
+		item.Reset()
+	}
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			item.WriteByte(',')
+			i++
+		case value[i] == ',':
+			flush()
+		default:
+			item.WriteByte(value[i])
+		}
+	}
+	flush()
+	return items
+}
+
+//parse blob categories like "IN:blob_user_data_in.proto, SOCIAL:blob_user_data_social.proto:SOCIAL_:BlobUserDataSocial:UID"
+//comma separates each category, `:` separates category name, proto file, and optional message prefix, blob table name and primary keys
+//message prefix is `<category name>_` by default, `#` separates multiple primary keys
+func parseBlobCategories(value string) ([]comm.BlobCategory, error) {
+	var categories []comm.BlobCategory
+	names := map[string]bool{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		infos := strings.Split(item, ":")
+		for j := range infos {
+			infos[j] = strings.TrimSpace(infos[j])
+		}
+		if len(infos) < 2 || len(infos) > 5 || infos[0] == "" || infos[1] == "" {
+			return nil, fmt.Errorf("illegal blob category %q", item)
+		}
+		cat := comm.BlobCategory{
+			Name:   infos[0],
+			File:   infos[1],
+			Prefix: infos[0] + "_",
+		}
+		if len(infos) > 2 && infos[2] != "" {
+			cat.Prefix = infos[2]
+		}
+		if len(infos) > 3 {
+			cat.Table = infos[3]
+		}
+		if len(infos) > 4 {
+			cat.Keys = splitItems(strings.Replace(infos[4], "#", ",", -1))
+		}
+		if names[cat.Name] {
+			return nil, fmt.Errorf("duplicate blob category %s", cat.Name)
+		}
+		names[cat.Name] = true
+		categories = append(categories, cat)
+	}
+	return categories, nil
+}
+
+//parse limits of blob categories like "OUT:64, IN:64", and set the limit of each category by setter
+func parseBlobLimits(value string, setter func(cat *comm.BlobCategory, num int)) error {
+	limits, err := parseMapItem(value)
+	if err != nil {
+		return err
+	}
+	for name, val := range limits {
+		num, err := strconv.Atoi(val)
+		if err != nil || num < 0 {
+			return fmt.Errorf("illegal limit %q of blob category %s", val, name)
+		}
+		found := false
+		for i := range comm.BlobCategories {
+			if comm.BlobCategories[i].Name == name {
+				setter(&comm.BlobCategories[i], num)
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown blob category %s", name)
+		}
+	}
+	return nil
+}
+
+//parse table name mapping: prefixes stripped, regex rewrites and explicit renames
+func parseTableNames(sec *ini.Section) error {
+	comm.TableNameStripPrefixes = splitItems(sec.Key("strip_prefixes").Value())
+	rewrites, err := parseRewrites(sec.Key("rewrites").Value())
+	if err != nil {
+		return fmt.Errorf("table_names rewrites error: %v", err)
+	}
+	comm.TableNameRewrites = rewrites
+	renames, err := parseMapItem(sec.Key("renames").Value())
+	if err != nil {
+		return fmt.Errorf("table_names renames error: %v", err)
+	}
+	comm.TableNameRenames = renames
+	for name, rename := range comm.TableNameRenames {
+		if rename == "" {
+			return fmt.Errorf("table_names renames error: empty name for %s", name)
+		}
+	}
+	return nil
+}
+
+//parse regex rewrites like "^Base(.*)$ => $1, Data$ => ", comma separates each rewrite, `=>` separates pattern and replacement
+//comma in pattern or replacement is escaped as `\,`, such as "^(\w{1\,3})_(.*)$ => $2"
+func parseRewrites(value string) ([]comm.NameRewrite, error) {
+	rewrites := []comm.NameRewrite{}
+	for _, item := range splitEscapedItems(value) {
+		infos := strings.SplitN(item, "=>", 2)
+		if len(infos) < 2 || strings.TrimSpace(infos[0]) == "" {
+			return nil, fmt.Errorf("illegal rewrite %q", item)
+		}
+		pattern, err := regexp.Compile(strings.TrimSpace(infos[0]))
+		if err != nil {
+			return nil, fmt.Errorf("illegal rewrite %q: %v", item, err)
+		}
+		rewrites = append(rewrites, comm.NameRewrite{Pattern: pattern, Replacement: strings.TrimSpace(infos[1])})
+	}
+	return rewrites, nil
+}
@@ -1,11 +1,13 @@
 package tools
 
 import (
+	"io/ioutil"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"gopkg.in/ini.v1"
 )
 
 func TestReadIni(t *testing.T) {
@@ -37,10 +39,10 @@ func TestParseCfg(t *testing.T) {
 	assert.Equal(t, "blob_user_data_in.proto", comm.BlobFiles["IN"])
 	assert.Equal(t, "blob_user_data_out.proto", comm.BlobFiles["OUT"])
 
-	assert.Equal(t, "blob_user_data_in", comm.BlobUserInMsg)
-	assert.Equal(t, "blob_user_data_out", comm.BlobUserOutMsg)
+	assert.Equal(t, "BlobUserDataIn", comm.BlobUserInMsg)
+	assert.Equal(t, "BlobUserDataOut", comm.BlobUserOutMsg)
 
-	assert.Equal(t, "common.proto, enumm_entity.proto", comm.IgnoreProtoFiles)
+	assert.Equal(t, "", comm.IgnoreProtoFiles)
 	assert.Equal(t, "common.proto", comm.CommonProtoFile)
 	assert.Equal(t, "enumm_entity.proto", comm.EnumProtoFile)
 	assert.Equal(t, "proto/entity/common.proto,proto/entity/enumm_entity.proto", strings.Join(comm.IgnoreImportPaths, ","))
@@ -48,3 +50,317 @@ func TestParseCfg(t *testing.T) {
 	assert.Equal(t, "tcaplusservice.optionv1.proto", comm.TcaplusImportName)
 
 }
+
+//config items added after the blob and import items checked by TestParseCfg
+func TestParseCfgItems(t *testing.T) {
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	assert.NoError(t, ParseCfg(cfg))
+
+	assert.Equal(t, "blob_user_data_social.proto", comm.BlobFiles["SOCIAL"])
+	assert.Equal(t, 3, len(comm.BlobCategories))
+	assert.Equal(t, comm.BlobCategory{Name: "SOCIAL", Prefix: "SOCIAL_", Table: "BlobUserDataSocial", File: "blob_user_data_social.proto", Keys: []string{"UID"}}, comm.BlobCategories[2])
+	assert.Equal(t, "IN_", comm.BlobCategories[0].Prefix)
+	assert.Equal(t, comm.BlobUserInMsg, comm.BlobCategories[0].Table)
+	assert.Equal(t, 0, comm.BlobCategories[1].MaxColumns)
+	assert.Equal(t, 0, comm.BlobCategories[1].MaxSize)
+	assert.Equal(t, "proto_parse.lock", comm.LockFile)
+	assert.Equal(t, []string{"OUT_", "IN_"}, comm.SplitMessagePrefixes)
+	assert.Equal(t, []string{"PUB_"}, comm.PubMessagePrefixes)
+	assert.Equal(t, []string{}, comm.TableNameStripPrefixes)
+	assert.Equal(t, 0, len(comm.TableNameRewrites))
+	assert.Equal(t, map[string]string{}, comm.TableNameRenames)
+	assert.Equal(t, "EntityType", comm.EntityMarkerType)
+	assert.Equal(t, []string{"UUID"}, comm.EntityKeyNames)
+	assert.Equal(t, []string{}, comm.EntityKeyTypes)
+	assert.Equal(t, []string{}, comm.PreserveFieldNumbers)
+	assert.Equal(t, "title", comm.NamingPolicy)
+	assert.Equal(t, []string{"ID", "UID", "UUID", "GUID", "URL", "IP"}, comm.NamingAcronyms)
+
+	assert.Equal(t, 0, len(comm.ShardingKeys))
+	assert.Equal(t, 0, len(comm.TableShardingKeys))
+
+	assert.Equal(t, "table_list_message.proto", comm.TableFiles["LIST"])
+	assert.Equal(t, "LIST_", comm.ListMessagePrefix)
+	assert.Equal(t, 1000, comm.ListMaxNum)
+	assert.Equal(t, 0, len(comm.ListTableMaxNums))
+
+	assert.Equal(t, 2, len(comm.InjectedColumns["SPLIT"]))
+	assert.Equal(t, "UID", comm.InjectedColumns["SPLIT"][0].Name)
+	assert.True(t, comm.InjectedColumns["SPLIT"][0].IsKey)
+	assert.Equal(t, "AddTime", comm.InjectedColumns["BaseAccounts"][0].Name)
+	assert.Equal(t, "tail", comm.InjectedColumns["BASE"][0].Position)
+
+	assert.Equal(t, 4, comm.TcaplusLimits.MaxKeyFields)
+	assert.Equal(t, 4, comm.TcaplusLimits.MaxIndexNum)
+	assert.Equal(t, 256, comm.TcaplusLimits.MaxFields)
+	assert.Equal(t, 10000, comm.TcaplusLimits.MaxListNum)
+	assert.Equal(t, "uint64", comm.TcaplusLimits.KeyFieldTypes[3])
+	assert.Equal(t, 0, len(comm.TcaplusLimits.ReservedFieldNames))
+}
+
+func TestParseMapItem(t *testing.T) {
+	items, err := parseMapItem("SPLIT:UID, BLOB : UID,, ")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, "UID", items["SPLIT"])
+	assert.Equal(t, "UID", items["BLOB"])
+
+	_, err = parseMapItem("SPLIT:UID, PUB")
+	assert.Error(t, err)
+	_, err = parseMapItem("SPLIT:UID, :x")
+	assert.Error(t, err)
+}
+
+func TestParseShardingKeys(t *testing.T) {
+	for value, ok := range map[string]bool{
+		"":                   true,
+		"SPLIT:UID, PUB:UID": true,
+		"SPLIT:UID, PUB":     false,
+		":UID":               false,
+		"SPLT:UID":           false,
+	} {
+		cfg, err := ReadIni("../config/proto_parse.cfg")
+		assert.NoError(t, err)
+		cfg.Section("business").Key("sharding_keys").SetValue(value)
+		err = ParseCfg(cfg)
+		assert.Equal(t, ok, err == nil, "%q %v", value, err)
+	}
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	cfg.Section("business").Key("sharding_keys").SetValue("SPLIT:UID, BLOB : UID")
+	assert.NoError(t, ParseCfg(cfg))
+	assert.Equal(t, map[string]string{"SPLIT": "UID", "BLOB": "UID"}, comm.ShardingKeys)
+}
+
+func TestParseColumns(t *testing.T) {
+	columns, err := parseColumns("UID:uint64:head:key, UpdateTime : uint64 : head, Version:uint32:tail")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(columns))
+	assert.Equal(t, comm.Column{Name: "UID", Type: "uint64", Position: "head", IsKey: true}, columns[0])
+	assert.Equal(t, comm.Column{Name: "UpdateTime", Type: "uint64", Position: "head"}, columns[1])
+	assert.Equal(t, comm.Column{Name: "Version", Type: "uint32", Position: "tail"}, columns[2])
+
+	columns, err = parseColumns("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(columns))
+
+	_, err = parseColumns("UID:uint64")
+	assert.Error(t, err)
+	_, err = parseColumns("UID:Foo:head")
+	assert.Error(t, err)
+	_, err = parseColumns("UID:uint64:middle")
+	assert.Error(t, err)
+	_, err = parseColumns("UID:uint64:head:index")
+	assert.Error(t, err)
+}
+
+func TestSplitItems(t *testing.T) {
+	assert.Equal(t, []string{"int32", "string"}, splitItems(" int32, ,string,"))
+	assert.Equal(t, []string{}, splitItems(""))
+	assert.Equal(t, []string{"a,b", "c"}, splitEscapedItems(` a\,b, ,c,`))
+	assert.Equal(t, []string{`a\`}, splitEscapedItems(`a\`))
+}
+
+func TestParseBlobCategories(t *testing.T) {
+	categories, err := parseBlobCategories("IN:blob_user_data_in.proto, BAG:blob_bag.proto:ITEM_, GUILD:blob_guild.proto::BlobGuild:GuildID#ZoneID")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(categories))
+	assert.Equal(t, comm.BlobCategory{Name: "IN", Prefix: "IN_", File: "blob_user_data_in.proto"}, categories[0])
+	assert.Equal(t, comm.BlobCategory{Name: "BAG", Prefix: "ITEM_", File: "blob_bag.proto"}, categories[1])
+	assert.Equal(t, comm.BlobCategory{Name: "GUILD", Prefix: "GUILD_", Table: "BlobGuild", File: "blob_guild.proto", Keys: []string{"GuildID", "ZoneID"}}, categories[2])
+
+	_, err = parseBlobCategories("IN")
+	assert.Error(t, err)
+	_, err = parseBlobCategories("IN:a.proto, IN:b.proto")
+	assert.Error(t, err)
+}
+
+func TestParseBlobLimits(t *testing.T) {
+	comm.BlobCategories = []comm.BlobCategory{{Name: "IN"}, {Name: "OUT"}}
+	err := parseBlobLimits("OUT:64, IN:32", func(cat *comm.BlobCategory, num int) {
+		cat.MaxColumns = num
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 32, comm.BlobCategories[0].MaxColumns)
+	assert.Equal(t, 64, comm.BlobCategories[1].MaxColumns)
+
+	err = parseBlobLimits("SOCIAL:64", func(cat *comm.BlobCategory, num int) {})
+	assert.Error(t, err)
+	err = parseBlobLimits("OUT:abc", func(cat *comm.BlobCategory, num int) {})
+	assert.Error(t, err)
+}
+
+func TestParseRewrites(t *testing.T) {
+	rewrites, err := parseRewrites("^Base(.*)$ => $1, Data$ =>")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rewrites))
+	assert.Equal(t, "GUID", rewrites[0].Pattern.ReplaceAllString("BaseGUID", rewrites[0].Replacement))
+	assert.Equal(t, "Role", rewrites[1].Pattern.ReplaceAllString("RoleData", rewrites[1].Replacement))
+
+	_, err = parseRewrites("^Base(.*$ => $1")
+	assert.Error(t, err)
+	_, err = parseRewrites("Base")
+	assert.Error(t, err)
+
+	//escaped comma is part of regex instead of separator
+	rewrites, err = parseRewrites(`^(\w{1\,3})_(.*)$ => $2, \,$ => `)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(rewrites))
+	assert.Equal(t, "Pet", rewrites[0].Pattern.ReplaceAllString("OUT_Pet", rewrites[0].Replacement))
+	assert.Equal(t, "LONGNAME_Pet", rewrites[0].Pattern.ReplaceAllString("LONGNAME_Pet", rewrites[0].Replacement))
+	assert.Equal(t, "Pet", rewrites[1].Pattern.ReplaceAllString("Pet,", rewrites[1].Replacement))
+	//unescaped comma cuts regex
+	_, err = parseRewrites(`^(\w{1,3})_(.*)$ => $2`)
+	assert.Error(t, err)
+
+	//escaped comma is kept by config file
+	cfg, err := ini.Load([]byte("[table_names]\n    rewrites = \"^(\\w{1\\,3})_(.*)$ => $2\"\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, parseTableNames(cfg.Section("table_names")))
+	assert.Equal(t, 1, len(comm.TableNameRewrites))
+	assert.Equal(t, `^(\w{1,3})_(.*)$`, comm.TableNameRewrites[0].Pattern.String())
+}
+
+//config template made from demo config
+func configTemplate(t *testing.T) string {
+	data, err := ioutil.ReadFile("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	return ConfigTemplate(string(data))
+}
+
+func TestConfigTemplate(t *testing.T) {
+	tmpl, err := ini.Load([]byte(configTemplate(t)))
+	assert.NoError(t, err)
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	//template has the same items as demo config, except base tables, blob categories and injected columns of specified tables
+	for _, sec := range cfg.Sections() {
+		for _, key := range sec.Keys() {
+			switch {
+			case sec.Name() == "injected_columns" && !containsItem(TableCategories, key.Name()):
+				assert.False(t, tmpl.Section(sec.Name()).HasKey(key.Name()), "%s.%s", sec.Name(), key.Name())
+			case key.Name() == "base_tables" || key.Name() == "base_table_primary_keys":
+				assert.Equal(t, "", tmpl.Section(sec.Name()).Key(key.Name()).Value(), key.Name())
+			case key.Name() == "blob_proto_files":
+				assert.Equal(t, "IN:blob_user_data_in.proto, OUT:blob_user_data_out.proto", tmpl.Section(sec.Name()).Key(key.Name()).Value())
+			default:
+				assert.Equal(t, key.Value(), tmpl.Section(sec.Name()).Key(key.Name()).Value(), "%s.%s", sec.Name(), key.Name())
+				assert.Equal(t, key.Comment, tmpl.Section(sec.Name()).Key(key.Name()).Comment, "%s.%s", sec.Name(), key.Name())
+			}
+		}
+	}
+	assert.NoError(t, ParseCfg(tmpl))
+	assert.Equal(t, "tcaplus_entity", comm.TcaplusPackageName)
+}
+
+func TestParseOverride(t *testing.T) {
+	override, err := ParseOverride("business.base_tables = BaseRoles, BaseGUID")
+	assert.NoError(t, err)
+	assert.Equal(t, Override{Section: "business", Key: "base_tables", Value: "BaseRoles, BaseGUID", Source: "--set"}, override)
+	override, err = ParseOverride("tcaplus_package_name=pkg")
+	assert.NoError(t, err)
+	assert.Equal(t, "tcaplusdb", override.Section)
+
+	_, err = ParseOverride("business.base_tables")
+	assert.Error(t, err)
+	_, err = ParseOverride("business.unknown=1")
+	assert.Error(t, err)
+	_, err = ParseOverride("tcaplusdb.base_tables=BaseRoles")
+	assert.Error(t, err)
+}
+
+func TestApplyOverrides(t *testing.T) {
+	overrides, warnings := EnvOverrides([]string{"HOME=/root", "PROTO_PARSE_TCAPLUS_LIST_MAX_NUM=500", "PROTO_PARSE_TCAPLUS_NAMING_POLICY=snake_case"})
+	assert.Nil(t, warnings)
+	assert.Equal(t, 2, len(overrides))
+
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	set, err := ParseOverride("business.naming_policy=lowerCamel")
+	assert.NoError(t, err)
+	//--set is applied after environment variables
+	sources := ApplyOverrides(cfg, append(overrides, set))
+	assert.Equal(t, "--set", sources["business.naming_policy"])
+	assert.NoError(t, ParseCfg(cfg))
+	assert.Equal(t, 500, comm.ListMaxNum)
+	assert.Equal(t, "lowerCamel", comm.NamingPolicy)
+
+	//effective config can be parsed to the same config
+	effective := EffectiveConfig(cfg, sources)
+	assert.Equal(t, "from PROTO_PARSE_TCAPLUS_LIST_MAX_NUM", effective.Section("business").Key("list_max_num").Comment)
+	assert.Equal(t, "from config file", effective.Section("business").Key("base_tables").Comment)
+	baseTables := comm.BaseTables
+	assert.NoError(t, ParseCfg(effective))
+	assert.Equal(t, baseTables, comm.BaseTables)
+	assert.Equal(t, 500, comm.ListMaxNum)
+}
+
+func TestEnvOverridesOfUnknownItems(t *testing.T) {
+	//unknown items are ignored with warnings, the known items are still applied
+	overrides, warnings := EnvOverrides([]string{"PROTO_PARSE_TCAPLUS_UNKNOWN=1", "PROTO_PARSE_TCAPLUS_LIST_MAX_NUM=500", "PROTO_PARSE_TCAPLUS_MAX_FIELDS=3"})
+	assert.Equal(t, []Override{{Section: "business", Key: "list_max_num", Value: "500", Source: "PROTO_PARSE_TCAPLUS_LIST_MAX_NUM"}}, overrides)
+	assert.Equal(t, []string{
+		"environment variable PROTO_PARSE_TCAPLUS_MAX_FIELDS is ignored, unknown item max_fields",
+		"environment variable PROTO_PARSE_TCAPLUS_UNKNOWN is ignored, unknown item unknown",
+	}, warnings)
+
+	//bad value of known item still fails the config
+	overrides, warnings = EnvOverrides([]string{"PROTO_PARSE_TCAPLUS_NAMING_POLICY=camel"})
+	assert.Nil(t, warnings)
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	ApplyOverrides(cfg, overrides)
+	assert.EqualError(t, ParseCfg(cfg), `naming_policy error: unknown policy "camel", should be one of preserve, title, PascalCase, snake_case, lowerCamel`)
+}
+
+func TestScaffoldConfig(t *testing.T) {
+	config := ScaffoldConfig(configTemplate(t), []string{"BaseVersion", "BaseGUID"}, map[string][]string{"BaseVersion": {"version"}, "BaseGUID": {"guid", "uid"}},
+		[]string{"OUT"}, []string{"BaseVersion: primary key version"})
+	assert.Contains(t, config, "    #BaseVersion: primary key version\n    base_tables = \"BaseVersion, BaseGUID\"\n")
+	cfg, err := ini.Load([]byte(config))
+	assert.NoError(t, err)
+	assert.NoError(t, ParseCfg(cfg))
+	assert.Equal(t, []string{"BaseVersion", "BaseGUID"}, comm.BaseTables)
+	assert.Equal(t, map[string]string{"BaseVersion": "version", "BaseGUID": "guid,uid"}, comm.BaseTableMap)
+	assert.Equal(t, map[string]string{"OUT": "blob_user_data_out.proto"}, comm.BlobFiles)
+}
+
+func TestParseCfgAgain(t *testing.T) {
+	items := map[string]string{
+		"naming_policy":          "snake_case",
+		"entity_marker_type":     "Marker",
+		"list_message_prefix":    "L_",
+		"list_max_num":           "10",
+		"lock_file":              "other.lock",
+		"proto_file_ignores":     "a.proto",
+		"blob_user_in_msg_name":  "In",
+		"blob_user_out_msg_name": "Out",
+		"table_sharding_keys":    "Guild:UUID",
+	}
+	cfg, err := ReadIni("../config/proto_parse.cfg")
+	assert.NoError(t, err)
+	for key, value := range items {
+		cfg.Section("business").Key(key).SetValue(value)
+	}
+	cfg.Section("tcaplusdb").Key("tcaplus_package_name").SetValue("pkg")
+	assert.NoError(t, ParseCfg(cfg))
+	assert.Equal(t, "snake_case", comm.NamingPolicy)
+	assert.Equal(t, "pkg", comm.TcaplusPackageName)
+
+	//items removed from config file are assigned by default, the same as a fresh run
+	for key := range items {
+		cfg.Section("business").DeleteKey(key)
+	}
+	cfg.Section("tcaplusdb").DeleteKey("tcaplus_package_name")
+	assert.NoError(t, ParseCfg(cfg))
+	assert.Equal(t, comm.GlobalNamingPolicy, comm.NamingPolicy)
+	assert.Equal(t, comm.GlobalEntityMarkerType, comm.EntityMarkerType)
+	assert.Equal(t, comm.GlobalListMessagePrefix, comm.ListMessagePrefix)
+	assert.Equal(t, comm.GlobalListMaxNum, comm.ListMaxNum)
+	assert.Equal(t, comm.GlobalLockFile, comm.LockFile)
+	assert.Equal(t, "", comm.IgnoreProtoFiles)
+	assert.Equal(t, comm.GlobalTcaplusPackageName, comm.TcaplusPackageName)
+	assert.Equal(t, map[string]string{}, comm.TableShardingKeys)
+	assert.Equal(t, comm.GlobalBlobUserInMsg, comm.BlobCategories[0].Table)
+}
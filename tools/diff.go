@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+//line of edit script, kind is ' ' for same line, '-' for deleted line and '+' for inserted line
+type diffLine struct {
+	kind byte
+	text string
+	//line numbers of old text and new text before this line
+	oldLine int
+	newLine int
+}
+
+//split text into lines, the last line without newline is also a line
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+//get edit script from old lines to new lines with longest common subsequence
+func diffLines(a []string, b []string) []diffLine {
+	//lcs[i][j] is the length of longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i, j = i+1, j+1
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i = i + 1
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j = j + 1
+		}
+	}
+	return lines
+}
+
+//unified diff from old text to new text with lines of context, empty string returned if the texts are the same
+func UnifiedDiff(oldText string, newText string, oldName string, newName string, context int) string {
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+	var b bytes.Buffer
+	for start := 0; start < len(lines); {
+		//first changed line of hunk
+		first := start
+		for first < len(lines) && lines[first].kind == ' ' {
+			first = first + 1
+		}
+		if first == len(lines) {
+			break
+		}
+		//last changed line of hunk, changes separated by no more than 2*context same lines are in the same hunk
+		last := first
+		for i := first + 1; i < len(lines) && i-last-1 <= 2*context; i++ {
+			if lines[i].kind != ' ' {
+				last = i
+			}
+		}
+		from := first - context
+		if from < start {
+			from = start
+		}
+		to := last + context + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+		oldCount, newCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.kind != '+' {
+				oldCount = oldCount + 1
+			}
+			if l.kind != '-' {
+				newCount = newCount + 1
+			}
+		}
+		oldStart, newStart := lines[from].oldLine, lines[from].newLine
+		if oldCount > 0 {
+			oldStart = oldStart + 1
+		}
+		if newCount > 0 {
+			newStart = newStart + 1
+		}
+		if b.Len() == 0 {
+			b.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", oldName, newName))
+		}
+		b.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, l := range lines[from:to] {
+			b.WriteString(fmt.Sprintf("%c%s\n", l.kind, l.text))
+		}
+		start = to
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"gopkg.in/ini.v1"
+)
+
+//prefix of environment variables overriding config items, followed by item name in upper case, such as PROTO_PARSE_TCAPLUS_BASE_TABLES
+const EnvPrefix = "PROTO_PARSE_TCAPLUS_"
+
+//items of sections which can be overridden by environment variables and --set, in the order of config file
+var OverrideItems = map[string][]string{
+	"business": {
+		"base_tables", "base_table_primary_keys", "table_proto_files", "blob_proto_files", "blob_max_columns", "blob_max_sizes",
+		"sharding_keys", "table_sharding_keys", "list_message_prefix", "list_max_num", "list_table_max_nums",
+		"blob_user_in_msg_name", "blob_user_out_msg_name", "split_message_prefixes", "pub_message_prefixes",
+		"entity_marker_type", "entity_key_names", "entity_key_types", "preserve_field_numbers", "naming_policy", "naming_acronyms",
+		"lock_file", "proto_file_ignores", "import_path_ignores",
+	},
+	"tcaplusdb": {"tcaplus_package_name", "tcaplus_import_path"},
+}
+
+//sections which can be overridden, in the order of config file
+var overrideSections = []string{"business", "tcaplusdb"}
+
+//config item overridden by environment variable or --set
+type Override struct {
+	Section string
+	Key     string
+	Value   string
+	//where the item comes from, such as `--set` or name of environment variable
+	Source string
+}
+
+//find section of config item, empty string returned if the item can not be overridden
+func overrideSection(key string) string {
+	for _, sec := range overrideSections {
+		if containsItem(OverrideItems[sec], key) {
+			return sec
+		}
+	}
+	return ""
+}
+
+//parse override like "business.base_tables=BaseRoles,BaseGUID" of --set, section is optional
+func ParseOverride(item string) (Override, error) {
+	infos := strings.SplitN(item, "=", 2)
+	if len(infos) < 2 {
+		return Override{}, fmt.Errorf("illegal override %q, should be section.key=value", item)
+	}
+	name := strings.TrimSpace(infos[0])
+	override := Override{Key: name, Value: strings.TrimSpace(infos[1]), Source: "--set"}
+	if i := strings.Index(name, "."); i >= 0 {
+		override.Section, override.Key = name[:i], name[i+1:]
+	}
+	section := overrideSection(override.Key)
+	if section == "" || (override.Section != "" && override.Section != section) {
+		return Override{}, fmt.Errorf("illegal override %q, unknown item %s", item, name)
+	}
+	override.Section = section
+	return override, nil
+}
+
+//get overrides from environment variables like "PROTO_PARSE_TCAPLUS_BASE_TABLES=BaseRoles,BaseGUID"
+//environment variables of unknown items are ignored and returned as warnings, values of known items are checked by ParseCfg
+func EnvOverrides(environ []string) ([]Override, []string) {
+	var overrides []Override
+	var warnings []string
+	for _, env := range environ {
+		if !strings.HasPrefix(env, EnvPrefix) {
+			continue
+		}
+		infos := strings.SplitN(env, "=", 2)
+		key := strings.ToLower(strings.TrimPrefix(infos[0], EnvPrefix))
+		section := overrideSection(key)
+		if section == "" {
+			warnings = append(warnings, fmt.Sprintf("environment variable %s is ignored, unknown item %s", infos[0], key))
+			continue
+		}
+		value := ""
+		if len(infos) > 1 {
+			value = strings.TrimSpace(infos[1])
+		}
+		overrides = append(overrides, Override{Section: section, Key: key, Value: value, Source: infos[0]})
+	}
+	//sort by name for stable precedence of duplicated items
+	sort.SliceStable(overrides, func(i, j int) bool {
+		return overrides[i].Source < overrides[j].Source
+	})
+	sort.Strings(warnings)
+	return overrides, warnings
+}
+
+//read config file and apply overrides, environment variables override config file and --set overrides both
+//sources map of overridden items is returned, key: `section.key`, value: source of item
+func ReadIniWithOverrides(iniFile string, sets []string) (*ini.File, map[string]string, error) {
+	cfg, err := ReadIni(iniFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	overrides, warnings := EnvOverrides(os.Environ())
+	for _, warn := range warnings {
+		//warnings are printed to standard error, so that the output of config print is still a config file
+		fmt.Fprintf(os.Stderr, "[WARNING] %v\n", warn)
+	}
+	for _, item := range sets {
+		override, err := ParseOverride(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		overrides = append(overrides, override)
+	}
+	return cfg, ApplyOverrides(cfg, overrides), nil
+}
+
+//apply overrides to config in order, later override takes precedence, sources of items are returned
+func ApplyOverrides(cfg *ini.File, overrides []Override) map[string]string {
+	sources := map[string]string{}
+	for _, override := range overrides {
+		cfg.Section(override.Section).Key(override.Key).SetValue(override.Value)
+		sources[override.Section+"."+override.Key] = override.Source
+	}
+	return sources
+}
+
+//build effective config from parsed config items, each item of business and tcaplusdb is commented with its source
+//other sections are copied from config file, ParseCfg must be called before
+func EffectiveConfig(cfg *ini.File, sources map[string]string) *ini.File {
+	effective := ini.Empty()
+	values := effectiveValues()
+	for _, name := range overrideSections {
+		sec := effective.Section(name)
+		for _, key := range OverrideItems[name] {
+			item, _ := sec.NewKey(key, values[key])
+			switch {
+			case sources[name+"."+key] != "":
+				item.Comment = "from " + sources[name+"."+key]
+			case cfg.Section(name).HasKey(key):
+				item.Comment = "from config file"
+			default:
+				item.Comment = "default"
+			}
+		}
+	}
+	for _, sec := range cfg.Sections() {
+		if sec.Name() == ini.DefaultSection || containsItem(overrideSections, sec.Name()) {
+			continue
+		}
+		newSec := effective.Section(sec.Name())
+		for _, key := range sec.Keys() {
+			newSec.NewKey(key.Name(), key.Value())
+		}
+	}
+	return effective
+}
+
+//format values of config items from parsed config
+func effectiveValues() map[string]string {
+	baseKeys := map[string]string{}
+	for table, keys := range comm.BaseTableMap {
+		baseKeys[table] = strings.Replace(keys, ",", ":", -1)
+	}
+	var categories []string
+	maxColumns, maxSizes := map[string]string{}, map[string]string{}
+	for _, cat := range comm.BlobCategories {
+		category := strings.Join([]string{cat.Name, cat.File, cat.Prefix, cat.Table}, ":")
+		if len(cat.Keys) > 0 {
+			category += ":" + strings.Join(cat.Keys, "#")
+		}
+		categories = append(categories, category)
+		if cat.MaxColumns > 0 {
+			maxColumns[cat.Name] = strconv.Itoa(cat.MaxColumns)
+		}
+		if cat.MaxSize > 0 {
+			maxSizes[cat.Name] = strconv.Itoa(cat.MaxSize)
+		}
+	}
+	listNums := map[string]string{}
+	for table, num := range comm.ListTableMaxNums {
+		listNums[table] = strconv.Itoa(num)
+	}
+	return map[string]string{
+		"base_tables":             strings.Join(comm.BaseTables, ", "),
+		"base_table_primary_keys": formatMapItem(baseKeys),
+		"table_proto_files":       formatMapItem(comm.TableFiles),
+		"blob_proto_files":        strings.Join(categories, ", "),
+		"blob_max_columns":        formatMapItem(maxColumns),
+		"blob_max_sizes":          formatMapItem(maxSizes),
+		"sharding_keys":           formatMapItem(comm.ShardingKeys),
+		"table_sharding_keys":     formatMapItem(comm.TableShardingKeys),
+		"list_message_prefix":     comm.ListMessagePrefix,
+		"list_max_num":            strconv.Itoa(comm.ListMaxNum),
+		"list_table_max_nums":     formatMapItem(listNums),
+		"blob_user_in_msg_name":   comm.BlobUserInMsg,
+		"blob_user_out_msg_name":  comm.BlobUserOutMsg,
+		"split_message_prefixes":  strings.Join(comm.SplitMessagePrefixes, ", "),
+		"pub_message_prefixes":    strings.Join(comm.PubMessagePrefixes, ", "),
+		"entity_marker_type":      comm.EntityMarkerType,
+		"entity_key_names":        strings.Join(comm.EntityKeyNames, ", "),
+		"entity_key_types":        strings.Join(comm.EntityKeyTypes, ", "),
+		"preserve_field_numbers":  strings.Join(comm.PreserveFieldNumbers, ", "),
+		"naming_policy":           comm.NamingPolicy,
+		"naming_acronyms":         strings.Join(comm.NamingAcronyms, ", "),
+		"lock_file":               comm.LockFile,
+		"proto_file_ignores":      comm.IgnoreProtoFiles,
+		"import_path_ignores":     strings.Join(comm.IgnoreImportPaths, ", "),
+		"tcaplus_package_name":    comm.TcaplusPackageName,
+		"tcaplus_import_path":     comm.TcaplusImportName,
+	}
+}
+
+//format map item like "KEY1:value1, KEY2:value2" sorted by key, reverse of parseMapItem
+func formatMapItem(items map[string]string) string {
+	var keys []string
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = key + ":" + items[key]
+	}
+	return strings.Join(keys, ", ")
+}
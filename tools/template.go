@@ -0,0 +1,78 @@
+package tools
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+//blob_proto_files item of config
+var blobFilesItem = regexp.MustCompile(`(?m)^(\s*blob_proto_files\s*=\s*)"([^"]*)"`)
+
+//make config template written by init command from demo config, so that they have the same items and comments
+//base tables are left empty, and blob categories other than the default ones and injected columns of specified tables are removed,
+//as they are for the demo proto files
+func ConfigTemplate(demo string) string {
+	lines := strings.Split(demo, "\n")
+	var ret []string
+	section := ""
+	for _, line := range lines {
+		item := strings.TrimSpace(line)
+		if strings.HasPrefix(item, "[") {
+			section = strings.Trim(item, "[]")
+		}
+		i := strings.Index(line, "=")
+		if i < 0 || strings.HasPrefix(item, "#") || strings.HasPrefix(item, ";") {
+			ret = append(ret, line)
+			continue
+		}
+		key := strings.TrimSpace(line[:i])
+		if section == "business" && (key == "base_tables" || key == "base_table_primary_keys") {
+			line = strings.TrimRight(line[:i], " ") + " = \"\""
+		}
+		if section == "injected_columns" && !containsItem(TableCategories, key) {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	var names []string
+	for _, cat := range comm.GlobalBlobCategories {
+		names = append(names, cat.Name)
+	}
+	return keepBlobCategories(strings.Join(ret, "\n"), names)
+}
+
+//keep blob categories with the names in blob_proto_files item of config, other categories are removed
+func keepBlobCategories(config string, names []string) string {
+	return blobFilesItem.ReplaceAllStringFunc(config, func(item string) string {
+		match := blobFilesItem.FindStringSubmatch(item)
+		var kept []string
+		for _, cat := range splitItems(match[2]) {
+			if containsItem(names, strings.TrimSpace(strings.SplitN(cat, ":", 2)[0])) {
+				kept = append(kept, cat)
+			}
+		}
+		return match[1] + "\"" + strings.Join(kept, ", ") + "\""
+	})
+}
+
+//fill base tables and their primary keys into config template, comments are put above base_tables item
+//primary keys are written like `table:key1:key2`, same as base_table_primary_keys item
+//blob categories of config template not in blobCategories are removed
+func ScaffoldConfig(template string, baseTables []string, primaryKeys map[string][]string, blobCategories []string, comments []string) string {
+	var keys []string
+	for _, table := range baseTables {
+		if len(primaryKeys[table]) > 0 {
+			keys = append(keys, table+":"+strings.Join(primaryKeys[table], ":"))
+		}
+	}
+	var lines []string
+	for _, comment := range comments {
+		lines = append(lines, "    #"+comment+"\n")
+	}
+	config := strings.Replace(keepBlobCategories(template, blobCategories), "    base_tables = \"\"\n",
+		strings.Join(lines, "")+"    base_tables = \""+strings.Join(baseTables, ", ")+"\"\n", 1)
+	return strings.Replace(config, "    base_table_primary_keys = \"\"\n",
+		"    base_table_primary_keys = \""+strings.Join(keys, ", ")+"\"\n", 1)
+}
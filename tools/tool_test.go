@@ -2,6 +2,8 @@ package tools
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSnakeCase(t *testing.T) {
@@ -11,3 +13,35 @@ func TestSnakeCase(t *testing.T) {
 	ret = SnakeCase("OUT_ChatBattles")
 	t.Log(ret)
 }
+
+func TestSplitWords(t *testing.T) {
+	assert.Equal(t, []string{"HTTP", "Server"}, SplitWords("HTTPServer"))
+	assert.Equal(t, []string{"OUT", "Chat", "Skins"}, SplitWords("OUT_ChatSkins"))
+	assert.Equal(t, []string{"role", "ID"}, SplitWords("roleID"))
+	assert.Equal(t, []string{"chaos", "battle"}, SplitWords("chaos__battle"))
+}
+
+func TestConvertName(t *testing.T) {
+	acronyms := []string{"ID", "UID"}
+	assert.Equal(t, "chaos_battle", ConvertName("chaos_battle", NamingPreserve, acronyms))
+	assert.Equal(t, "Chaos_battle", ConvertName("chaos_battle", NamingTitle, acronyms))
+	assert.Equal(t, "ChaosBattle", ConvertName("chaos_battle", NamingPascalCase, acronyms))
+	assert.Equal(t, "UserID", ConvertName("user_id", NamingPascalCase, acronyms))
+	assert.Equal(t, "OutChaosBattle", ConvertName("OUT_ChaosBattle", NamingPascalCase, acronyms))
+	assert.Equal(t, "BlobUserDataOut_1", ConvertName("BlobUserDataOut_1", NamingPascalCase, acronyms))
+	assert.Equal(t, "update_time", ConvertName("UpdateTime", NamingSnakeCase, acronyms))
+	assert.Equal(t, "uidList", ConvertName("UID_list", NamingLowerCamel, acronyms))
+	assert.Equal(t, "roleID", ConvertName("role_id", NamingLowerCamel, acronyms))
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Equal(t, "", UnifiedDiff("a\nb\n", "a\nb\n", "a/x", "b/x", 3))
+	assert.Equal(t, "--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		UnifiedDiff("a\nb\nc\n", "a\nB\nc\n", "a/x", "b/x", 1))
+	assert.Equal(t, "--- /dev/null\n+++ b/x\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		UnifiedDiff("", "a\nb\n", "/dev/null", "b/x", 3))
+	//changes far apart are in separate hunks
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	diff := UnifiedDiff(old, "0\n2\n3\n4\n5\n6\n7\n9\n", "a/x", "b/x", 1)
+	assert.Equal(t, "--- a/x\n+++ b/x\n@@ -1,2 +1,2 @@\n-1\n+0\n 2\n@@ -7,2 +7,2 @@\n 7\n-8\n+9\n", diff)
+}
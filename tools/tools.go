@@ -82,6 +82,129 @@ func SnakeCase(str string) string {
 	return string(out)
 }
 
+//naming policies of generated names
+const (
+	//keep names unchanged
+	NamingPreserve string = "preserve"
+	//upper the first letter, chaos_battle => Chaos_battle
+	NamingTitle string = "title"
+	//chaos_battle => ChaosBattle
+	NamingPascalCase string = "PascalCase"
+	//ChaosBattle => chaos_battle
+	NamingSnakeCase string = "snake_case"
+	//chaos_battle => chaosBattle
+	NamingLowerCamel string = "lowerCamel"
+)
+
+//all naming policies
+var NamingPolicies = []string{NamingPreserve, NamingTitle, NamingPascalCase, NamingSnakeCase, NamingLowerCamel}
+
+//convert name by naming policy, words in acronyms are kept in upper case by PascalCase and lowerCamel policies
+func ConvertName(name string, policy string, acronyms []string) string {
+	switch policy {
+	case NamingTitle:
+		return UpperFirst(name)
+	case NamingPascalCase:
+		return PascalCase(name, acronyms)
+	case NamingSnakeCase:
+		return SnakeCase(name)
+	case NamingLowerCamel:
+		return LowerCamel(name, acronyms)
+	}
+	return name
+}
+
+//chaos_battle => Chaos_battle
+func UpperFirst(str string) string {
+	in := []rune(str)
+	if len(in) == 0 {
+		return str
+	}
+	in[0] = unicode.ToUpper(in[0])
+	return string(in)
+}
+
+//split name into words by underscores and case changes, the same word boundaries as SnakeCase
+//HTTPServer => HTTP Server, OUT_ChatSkins => OUT Chat Skins, roleID => role ID
+func SplitWords(str string) []string {
+	in := []rune(str)
+	isLower := func(idx int) bool {
+		return idx >= 0 && idx < len(in) && unicode.IsLower(in[idx])
+	}
+	var words []string
+	word := make([]rune, 0, len(in))
+	for i, r := range in {
+		if r == '_' {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word = word[:0]
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 && (isLower(i-1) || isLower(i+1)) {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+//chaos_battle => ChaosBattle, user_id => UserID if ID is an acronym
+//numeric word is kept separated by underscore, BlobUserData_1 => BlobUserData_1
+func PascalCase(str string, acronyms []string) string {
+	return joinWords(SplitWords(str), acronyms, false)
+}
+
+//ChaosBattle => chaosBattle, UserID => userID if ID is an acronym
+func LowerCamel(str string, acronyms []string) string {
+	return joinWords(SplitWords(str), acronyms, true)
+}
+
+func joinWords(words []string, acronyms []string, lowerFirst bool) string {
+	var out strings.Builder
+	for i, word := range words {
+		if isNumeric(word) {
+			if i > 0 {
+				out.WriteString("_")
+			}
+			out.WriteString(word)
+			continue
+		}
+		if i == 0 && lowerFirst {
+			out.WriteString(strings.ToLower(word))
+			continue
+		}
+		if isAcronym(word, acronyms) {
+			out.WriteString(strings.ToUpper(word))
+			continue
+		}
+		out.WriteString(UpperFirst(strings.ToLower(word)))
+	}
+	return out.String()
+}
+
+func isAcronym(word string, acronyms []string) bool {
+	for _, acronym := range acronyms {
+		if strings.EqualFold(word, acronym) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNumeric(word string) bool {
+	for _, r := range word {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
 //traverse proto files of specified directory
 func GetProtoFiles(root string, ignores string) ([]string, error) {
 	protoFiles := []string{}
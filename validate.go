@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+	"github.com/tencentyun/proto-parse-tcaplus/tools"
+)
+
+//violation of tcaplusdb engine limits
+type violation struct {
+	//proto file of table
+	file string
+	//table name
+	table string
+	//field name, empty for table level violation
+	field string
+	//source message or field which causes the violation
+	source string
+	detail string
+}
+
+//protobuf field number range, numbers 19000 through 19999 are reserved by protobuf
+const (
+	maxFieldNumber           int = 536870911
+	firstReservedFieldNumber int = 19000
+	lastReservedFieldNumber  int = 19999
+)
+
+//index option value, such as `index_1(UID),index_2(UID,Name)`
+var indexPattern = regexp.MustCompile(`(\w+)\(([^)]*)\)`)
+
+//validate generated tables against tcaplusdb engine limits
+//every violation is saved into violations, and the proto file of the table fails to convert
+func validateTables() {
+	var files []string
+	for file := range tables {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	//source table names of each generated table name, for checking table names collision
+	names := map[string]string{}
+	for _, file := range files {
+		num := 0
+		for _, t := range tables[file] {
+			for _, v := range validateTable(t) {
+				v.file = file
+				violations = append(violations, v)
+				num = num + 1
+			}
+			if name, ok := names[t.msg.Name]; ok {
+				detail := fmt.Sprintf("duplicate table name %s", t.msg.Name)
+				if name != t.name {
+					detail = fmt.Sprintf("%s and %s are both named %s by table name mapping and naming policy %s", name, t.name, t.msg.Name, comm.NamingPolicy)
+				}
+				violations = append(violations, violation{file: file, table: t.msg.Name, source: t.name, detail: detail})
+				num = num + 1
+			} else {
+				names[t.msg.Name] = t.name
+			}
+		}
+		if num > 0 {
+			addErrorInfo(file, fmt.Sprintf("%d violations of tcaplusdb limits", num))
+		}
+	}
+}
+
+func validateTable(t table) []violation {
+	var vs []violation
+	limits := comm.TcaplusLimits
+	add := func(field string, detail string, args ...interface{}) {
+		v := violation{table: t.msg.Name, field: field, source: t.source, detail: fmt.Sprintf(detail, args...)}
+		if source, ok := t.fieldSources[field]; ok {
+			v.source = source
+		}
+		vs = append(vs, v)
+	}
+
+	//primary key fields
+	keys := splitKeys(t.option(primaryKeyOption))
+	if len(keys) == 0 {
+		add("", "no primary key")
+	}
+	if len(keys) > limits.MaxKeyFields {
+		add("", "%d primary key fields exceed the limit %d", len(keys), limits.MaxKeyFields)
+	}
+	for _, key := range keys {
+		field, ok := tableField(t, key)
+		if !ok {
+			add("", "primary key field %s not exist", key)
+			continue
+		}
+		if field.IsRepeated {
+			add(key, "primary key field %s is repeated", key)
+		}
+		if !containsString(limits.KeyFieldTypes, field.Type) {
+			add(key, "primary key field %s type %s not allowed, allowed types: %s", key, field.Type, strings.Join(limits.KeyFieldTypes, ","))
+		}
+	}
+
+	//indexes, index fields must be part of primary key
+	indexes := indexPattern.FindAllStringSubmatch(t.option(indexOption), -1)
+	if len(indexes) > limits.MaxIndexNum {
+		add("", "%d indexes exceed the limit %d", len(indexes), limits.MaxIndexNum)
+	}
+	for _, index := range indexes {
+		for _, key := range splitKeys(index[2]) {
+			if !containsString(keys, key) {
+				add(key, "index %s field %s is not part of primary key", index[1], key)
+			}
+		}
+	}
+
+	//list num of list table
+	if customAttr := t.option(customAttrOption); customAttr != "" {
+		for _, attr := range strings.Split(customAttr, ";") {
+			if !strings.HasPrefix(attr, "ListNum=") {
+				continue
+			}
+			num, err := strconv.Atoi(strings.TrimPrefix(attr, "ListNum="))
+			if err != nil || num <= 0 || num > limits.MaxListNum {
+				add("", "list max num %s out of range (0, %d]", strings.TrimPrefix(attr, "ListNum="), limits.MaxListNum)
+			}
+		}
+	}
+
+	//fields
+	if len(t.msg.Fields) > limits.MaxFields {
+		add("", "%d fields exceed the limit %d", len(t.msg.Fields), limits.MaxFields)
+	}
+	names := map[string]bool{}
+	ids := map[int]string{}
+	for _, field := range t.msg.Fields {
+		if names[field.Name] {
+			if source, ok := t.collisions[field.Name]; ok && comm.NamingPolicy != tools.NamingPreserve {
+				add(field.Name, "%s and %s are both named %s by naming policy %s", t.fieldSources[field.Name], source, field.Name, comm.NamingPolicy)
+			} else {
+				add(field.Name, "duplicate field name %s", field.Name)
+			}
+		}
+		names[field.Name] = true
+		if name, ok := ids[field.ID]; ok {
+			add(field.Name, "field number %d of %s is already used by %s", field.ID, field.Name, name)
+		} else {
+			ids[field.ID] = field.Name
+		}
+		if field.ID < 1 || field.ID > maxFieldNumber || (field.ID >= firstReservedFieldNumber && field.ID <= lastReservedFieldNumber) {
+			add(field.Name, "illegal field number %d of %s", field.ID, field.Name)
+		}
+		for _, reserved := range limits.ReservedFieldNames {
+			if strings.EqualFold(field.Name, reserved) {
+				add(field.Name, "field name %s is reserved", field.Name)
+			}
+		}
+		//reserved entries of table
+		for _, id := range t.msg.ReservedIDs {
+			if field.ID == id {
+				add(field.Name, "field number %d of %s is reserved by the table", field.ID, field.Name)
+			}
+		}
+		if containsString(t.msg.ReservedNames, field.Name) {
+			add(field.Name, "field name %s is reserved by the table", field.Name)
+		}
+	}
+	return vs
+}
+
+//get field of table by name
+func tableField(t table, name string) (comm.Field, bool) {
+	for _, field := range t.msg.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return comm.Field{}, false
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (v violation) String() string {
+	location := v.table
+	if v.field != "" {
+		location = fmt.Sprintf("%s.%s", v.table, v.field)
+	}
+	if v.source == "" {
+		return fmt.Sprintf("[%v] invalid [%v] %v", v.file, location, v.detail)
+	}
+	return fmt.Sprintf("[%v] invalid [%v] %v, source: %v", v.file, location, v.detail, v.source)
+}
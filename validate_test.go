@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tencentyun/proto-parse-tcaplus/comm"
+)
+
+func TestValidateTable(t *testing.T) {
+	comm.ResetConfig()
+	defer comm.ResetConfig()
+	comm.TcaplusLimits = comm.Limits{MaxKeyFields: 2, MaxIndexNum: 1, MaxFields: 4, MaxListNum: 100,
+		KeyFieldTypes: []string{"uint64", "string"}, ReservedFieldNames: []string{"Version"}}
+	cases := []struct {
+		name    string
+		edit    func(t *table)
+		details []string
+	}{
+		{"valid", func(t *table) {}, nil},
+		{"no primary key", func(t *table) {
+			t.msg.Options = nil
+		}, []string{"no primary key"}},
+		{"too many key fields", func(t *table) {
+			t.msg.Options[0].Value = "UID,Name,UID"
+		}, []string{"3 primary key fields exceed the limit 2"}},
+		{"key field not exist", func(t *table) {
+			t.msg.Options[0].Value = "UID,Zone"
+		}, []string{"primary key field Zone not exist"}},
+		{"key field type", func(t *table) {
+			t.msg.Options[0].Value = "UID,Level"
+		}, []string{"primary key field Level type uint32 not allowed, allowed types: uint64,string"}},
+		{"repeated key field", func(t *table) {
+			t.msg.Fields[1].IsRepeated = true
+			t.msg.Options[0].Value = "UID,Name"
+		}, []string{"primary key field Name is repeated"}},
+		{"index fields in primary key", func(t *table) {
+			t.msg.Options = append(t.msg.Options, comm.Option{Name: indexOption, Value: "index_1(UID)"})
+		}, nil},
+		{"index field not in primary key", func(t *table) {
+			t.msg.Options = append(t.msg.Options, comm.Option{Name: indexOption, Value: "index_1(UID,Name)"})
+		}, []string{"index index_1 field Name is not part of primary key"}},
+		{"too many indexes", func(t *table) {
+			t.msg.Options = append(t.msg.Options, comm.Option{Name: indexOption, Value: "index_1(UID),index_2(UID)"})
+		}, []string{"2 indexes exceed the limit 1"}},
+		{"list num", func(t *table) {
+			t.msg.Options = append(t.msg.Options, comm.Option{Name: customAttrOption, Value: "TableType=LIST;ListNum=100"})
+		}, nil},
+		{"list num out of range", func(t *table) {
+			t.msg.Options = append(t.msg.Options, comm.Option{Name: customAttrOption, Value: "TableType=LIST;ListNum=101"})
+		}, []string{"list max num 101 out of range (0, 100]"}},
+		{"too many fields", func(t *table) {
+			t.msg.Fields = append(t.msg.Fields, comm.Field{ID: 4, Name: "Exp", Type: "uint32"}, comm.Field{ID: 5, Name: "Star", Type: "uint32"})
+		}, []string{"5 fields exceed the limit 4"}},
+		{"duplicate field name", func(t *table) {
+			t.msg.Fields[2].Name = "Name"
+		}, []string{"duplicate field name Name"}},
+		{"duplicate field number", func(t *table) {
+			t.msg.Fields[2].ID = 2
+		}, []string{"field number 2 of Level is already used by Name"}},
+		{"illegal field number", func(t *table) {
+			t.msg.Fields[2].ID = 19000
+		}, []string{"illegal field number 19000 of Level"}},
+		{"reserved field name of tcaplusdb", func(t *table) {
+			t.msg.Fields[2].Name = "version"
+		}, []string{"field name version is reserved"}},
+		{"field number reserved by table", func(t *table) {
+			t.msg.ReservedIDs = []int{3}
+		}, []string{"field number 3 of Level is reserved by the table"}},
+		{"field name reserved by table", func(t *table) {
+			t.msg.ReservedNames = []string{"Level"}
+		}, []string{"field name Level is reserved by the table"}},
+	}
+	for _, c := range cases {
+		tb := table{name: "T", source: "OUT_T", fieldSources: map[string]string{}, collisions: map[string]string{}, msg: comm.Message{
+			Name:    "T",
+			Options: []comm.Option{{Name: primaryKeyOption, Value: "UID"}},
+			Fields: []comm.Field{
+				{ID: 1, Name: "UID", Type: "uint64"},
+				{ID: 2, Name: "Name", Type: "string"},
+				{ID: 3, Name: "Level", Type: "uint32"},
+			},
+		}}
+		c.edit(&tb)
+		var details []string
+		for _, v := range validateTable(tb) {
+			details = append(details, v.detail)
+		}
+		assert.Equal(t, c.details, details, c.name)
+	}
+}
+
+func TestValidateTables(t *testing.T) {
+	resetParseState()
+	comm.ResetConfig()
+	key := []comm.Option{{Name: primaryKeyOption, Value: "UID"}}
+	fields := []comm.Field{{ID: 1, Name: "UID", Type: "uint64"}}
+	//tables mapped to the same name fail their proto file
+	tables = map[string][]table{
+		"a.proto": {{name: "OUT_Pet", msg: comm.Message{Name: "Pet", Options: key, Fields: fields}}},
+		"b.proto": {{name: "IN_Pet", msg: comm.Message{Name: "Pet", Options: key, Fields: fields}}},
+	}
+	validateTables()
+	assert.Equal(t, 1, len(violations))
+	assert.Equal(t, "[b.proto] invalid [Pet] OUT_Pet and IN_Pet are both named Pet by table name mapping and naming policy title, source: IN_Pet", violations[0].String())
+	assert.Equal(t, map[string]string{"b.proto": "1 violations of tcaplusdb limits"}, errorInfos)
+}
+
+func TestWriteOnlyValidTables(t *testing.T) {
+	//blob category without messages fails its own proto file, the others are written
+	src, dst := copyTestdata(t), t.TempDir()
+	assert.NoError(t, os.Remove(filepath.Join(src, "social.proto")))
+	assert.NoError(t, convertForTest(t, src, dst))
+	assert.Equal(t, "no SOCIAL blob messages", errorInfos["blob_user_data_social.proto"])
+	assert.FileExists(t, filepath.Join(dst, "blob_user_data_in.proto"))
+	assert.FileExists(t, filepath.Join(dst, comm.LockFile))
+
+	//invalid table stops writing any file
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	assert.NoError(t, ioutil.WriteFile(config, regexp.MustCompile(`max_fields = \d+`).ReplaceAll(data, []byte("max_fields = 3")), 0644))
+	dst = t.TempDir()
+	err = convertWithConfig(t, config, src, dst)
+	assert.Equal(t, exitValidation, errorCode(err))
+	files, _ := ioutil.ReadDir(dst)
+	assert.Equal(t, 0, len(files))
+}
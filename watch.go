@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//interval of polling source files and config file for changes
+const watchInterval = 500 * time.Millisecond
+
+//changes are handled after no more changes in debounce time, so that saving several files runs once
+const watchDebounce = time.Second
+
+//modification state of watched file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+//get states of all files in source path and config file
+func watchedFiles(srcPath string, cfgFile string) map[string]fileState {
+	states := map[string]fileState{}
+	filepath.Walk(srcPath, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			states[path] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	if info, err := os.Stat(cfgFile); err == nil {
+		states[cfgFile] = fileState{info.ModTime(), info.Size()}
+	}
+	return states
+}
+
+func sameFiles(a map[string]fileState, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		if s, ok := b[path]; !ok || s != state {
+			return false
+		}
+	}
+	return true
+}
+
+//run once, then watch source path and config file, and run again on changes until the process is stopped
+func watchAndRun(srcPath string, cfgFile string, run func()) {
+	last := watchedFiles(srcPath, cfgFile)
+	run()
+	fmt.Printf("Watching %s and %s for changes\n", srcPath, cfgFile)
+	pending := false
+	var changedAt time.Time
+	for {
+		time.Sleep(watchInterval)
+		current := watchedFiles(srcPath, cfgFile)
+		if !sameFiles(last, current) {
+			last = current
+			pending = true
+			changedAt = time.Now()
+			continue
+		}
+		if pending && time.Since(changedAt) >= watchDebounce {
+			pending = false
+			fmt.Printf("Changes detected at %s, regenerating\n", changedAt.Format("15:04:05"))
+			run()
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertAgainMatchesFreshRun(t *testing.T) {
+	//config without the items changed below
+	data, err := ioutil.ReadFile("config/proto_parse.cfg")
+	assert.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "proto_parse.cfg")
+	removed := regexp.MustCompile(`(?m)^\s*(naming_policy|list_max_num|lock_file|tcaplus_package_name)\s*=.*\n`)
+	assert.NoError(t, ioutil.WriteFile(config, removed.ReplaceAll(data, nil), 0644))
+
+	fresh, again := t.TempDir(), t.TempDir()
+	assert.NoError(t, convertWithConfig(t, config, "testdata/test", fresh))
+
+	//convert with the items set, then convert again after the items are removed, like watch mode
+	configSets = []string{"naming_policy=snake_case", "list_max_num=10", "lock_file=other.lock", "tcaplus_package_name=pkg"}
+	assert.NoError(t, convertWithConfig(t, config, "testdata/test", t.TempDir()))
+	configSets = nil
+	assert.NoError(t, convertWithConfig(t, config, "testdata/test", again))
+
+	files, err := ioutil.ReadDir(fresh)
+	assert.NoError(t, err)
+	for _, f := range files {
+		want, err := ioutil.ReadFile(filepath.Join(fresh, f.Name()))
+		assert.NoError(t, err)
+		got, err := ioutil.ReadFile(filepath.Join(again, f.Name()))
+		assert.NoError(t, err)
+		assert.Equal(t, string(want), string(got), f.Name())
+	}
+}